@@ -4,20 +4,49 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/solidcopy/utag/internal/atomicfile"
+	"github.com/solidcopy/utag/internal/config"
 	"github.com/solidcopy/utag/internal/service"
 )
 
 func main() {
 
+	conf, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// --key=valueの形式の引数は設定として扱い、それ以外を位置引数とする
+	args := []string{}
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "--") {
+			args = append(args, arg)
+			continue
+		}
+
+		key, value, found := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !found {
+			value = "true"
+		}
+
+		err = conf.Set(key, value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	var serviceArg string
-	if len(os.Args) >= 2 {
-		serviceArg = os.Args[1]
+	if len(args) >= 1 {
+		serviceArg = args[0]
 	}
 
 	var dir string
-	if len(os.Args) >= 3 {
-		dir = os.Args[2]
+	if len(args) >= 2 {
+		dir = args[1]
 	} else {
 		wd, err := os.Getwd()
 		if err != nil {
@@ -27,6 +56,9 @@ func main() {
 		dir = wd
 	}
 
+	// 前回の実行が中断された時の一時ファイルを削除する
+	atomicfile.CleanUp(dir)
+
 	serviceList, err := selectServices(serviceArg, dir)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -34,11 +66,11 @@ func main() {
 	}
 
 	for _, service := range serviceList {
-		service(dir)
+		service(dir, conf)
 	}
 }
 
-type ServiceFunc func(string)
+type ServiceFunc func(string, *config.Config)
 
 func selectServices(args string, dir string) ([]ServiceFunc, error) {
 	if args == "" {
@@ -61,6 +93,16 @@ func selectServicesByArgs(arg string) (ServiceFunc, error) {
 		return service.ExecuteImport, nil
 	case "r":
 		return service.ExecuteRename, nil
+	case "f":
+		return service.ExecuteFeat, nil
+	case "lookup":
+		return service.ExecuteLookup, nil
+	case "c":
+		return service.ExecuteCue, nil
+	case "split":
+		return service.ExecuteSplit, nil
+	case "verify":
+		return service.ExecuteVerify, nil
 	default:
 		err := fmt.Errorf("サブコマンドが不正です。 \"%s\"", arg)
 		return nil, err
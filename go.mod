@@ -8,10 +8,13 @@ require (
 	github.com/go-flac/flacpicture v0.3.0
 	github.com/go-flac/flacvorbis v0.2.0
 	github.com/go-flac/go-flac v1.0.0
+	github.com/mewkiz/flac v1.0.12
 	golang.org/x/exp v0.0.0-20230801115018-d63ba01acd4b
+	golang.org/x/text v0.12.0
 )
 
 require (
 	github.com/google/uuid v1.1.2 // indirect
-	golang.org/x/text v0.12.0 // indirect
+	github.com/icza/bitio v1.1.0 // indirect
+	github.com/mewkiz/pkg v0.0.0-20230226050401-4010bf0fec14 // indirect
 )
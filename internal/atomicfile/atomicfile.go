@@ -0,0 +1,202 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 一時ファイルの拡張子
+const tempExt = ".utag_temp"
+
+// 既存のファイルを置き換えるための一時ファイル。
+// 同じディレクトリに書き込み、Commitで元のファイルと置き換える。
+// 途中で失敗しても元のファイルは壊れない。
+type File struct {
+	*os.File
+	path string
+	done bool
+}
+
+// pathを置き換える一時ファイルを作成する。pathのファイルはなくてもよい。
+func Create(path string) (*File, error) {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+tempExt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{File: temp, path: path}, nil
+}
+
+// 一時ファイルをディスクに書き込み、元のファイルのパーミッションと更新日時を引き継いで置き換える。
+// 元のファイルがなければパーミッションを0644にして作成する。
+func (f *File) Commit() error {
+	if f.done {
+		return nil
+	}
+	defer f.Abort()
+
+	err := f.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	if stat, err := os.Stat(f.path); err == nil {
+		err = os.Chmod(f.Name(), stat.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		err = os.Chtimes(f.Name(), stat.ModTime(), stat.ModTime())
+		if err != nil {
+			return err
+		}
+	} else {
+		// 一時ファイルは所有者しか読み書きできないので、通常のファイルと同じにする
+		err = os.Chmod(f.Name(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(f.Name(), f.path)
+	if err != nil {
+		return err
+	}
+	f.done = true
+
+	// リネームをディスクに反映する
+	if dir, err := os.Open(filepath.Dir(f.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// 一時ファイルに書き込んだ内容を読み込む。Commitする前に内容を確認するために使う。
+func (f *File) Content() (*io.SectionReader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(f.File, 0, stat.Size()), nil
+}
+
+// Commitしていなければ一時ファイルを削除する。
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// 前回の実行で残った一時ファイルを削除する。
+func CleanUp(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), tempExt) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// ファイルを置き換えずに、offsetの位置からdataを上書きする。
+// タグの領域など、書き込みが中断しても音声データには影響しない部分の書き換えに使う。
+// 更新日時は元のファイルから引き継ぐ。
+func WriteAt(path string, data []byte, offset int64) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteAt(data, offset)
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, stat.ModTime(), stat.ModTime())
+}
+
+// サイズがsizeのbaseのoffsetの位置をdataで上書きした内容を読み込む。baseは変更しない。
+// WriteAtで上書きする前に、上書きした後の内容を確認するために使う。offsetはsize以下とする。
+func Patch(base io.ReaderAt, size int64, data []byte, offset int64) *io.SectionReader {
+	r := &patchedReader{base: base, size: size, data: data, offset: offset}
+	return io.NewSectionReader(r, 0, max(size, offset+int64(len(data))))
+}
+
+type patchedReader struct {
+	base   io.ReaderAt
+	size   int64
+	data   []byte
+	offset int64
+}
+
+func (r *patchedReader) ReadAt(p []byte, off int64) (int, error) {
+	end := max(r.size, r.offset+int64(len(r.data)))
+	if off >= end {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), end-off))
+
+	// 元の内容を読み込んでから、上書きする部分を重ねる
+	if off < r.size {
+		_, err := r.base.ReadAt(p[:min(int64(n), r.size-off)], off)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	start := max(off, r.offset)
+	stop := min(off+int64(n), r.offset+int64(len(r.data)))
+	if start < stop {
+		copy(p[start-off:stop-off], r.data[start-r.offset:stop-r.offset])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 書き込んだ後の内容rから求めた音声データのハッシュが、書き込む前のハッシュwantと同じか確認する。
+// 置き換えや上書きの前に確認し、音声データが変わる場合は書き込みを中止する。
+func CheckHash(r *io.SectionReader, hash func(r *io.SectionReader) (string, error), want string) error {
+	got, err := hash(r)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return errors.New("タグの書き込みで音声データが変わるので、書き込みを中止しました。")
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package atomicfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	base := []byte("0123456789")
+
+	tests := []struct {
+		name   string
+		data   string
+		offset int64
+		want   string
+	}{
+		{"先頭", "ab", 0, "ab23456789"},
+		{"途中", "abc", 4, "0123abc789"},
+		{"末尾", "ab", 8, "01234567ab"},
+		{"末尾を超える", "abcd", 8, "01234567abcd"},
+		{"末尾に追加", "abc", 10, "0123456789abc"},
+		{"空", "", 3, "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Patch(bytes.NewReader(base), int64(len(base)), []byte(tt.data), tt.offset)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			// 一部分だけを読み込んでも同じ内容になる
+			for off := 0; off < len(tt.want); off++ {
+				for n := 1; off+n <= len(tt.want); n++ {
+					p := make([]byte, n)
+					_, err := r.ReadAt(p, int64(off))
+					if err != nil && err != io.EOF {
+						t.Fatal(err)
+					}
+					if string(p) != tt.want[off:off+n] {
+						t.Fatalf("ReadAt(%d, %d) = %q, want %q", off, n, p, tt.want[off:off+n])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPatchNested(t *testing.T) {
+	base := []byte("0123456789")
+	r := Patch(bytes.NewReader(base), int64(len(base)), []byte("ab"), 2)
+	r = Patch(r, r.Size(), []byte("xyz"), 9)
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "01ab45678xyz" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCheckHash(t *testing.T) {
+	hash := func(r *io.SectionReader) (string, error) {
+		data, err := io.ReadAll(r)
+		return strings.ToUpper(string(data)), err
+	}
+
+	r := io.NewSectionReader(strings.NewReader("abc"), 0, 3)
+	if err := CheckHash(r, hash, "ABC"); err != nil {
+		t.Error(err)
+	}
+	if err := CheckHash(r, hash, "ABD"); err == nil {
+		t.Error("ハッシュが異なるのにエラーにならない")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(path, []byte("old"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := f.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(content); string(data) != "new" {
+		t.Errorf("Content = %q", data)
+	}
+
+	err = f.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("ファイルの内容 = %q", data)
+	}
+	if stat, _ := os.Stat(path); stat.Mode().Perm() != 0600 {
+		t.Errorf("パーミッション = %v", stat.Mode().Perm())
+	}
+}
+
+func TestAbort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	err := os.WriteFile(path, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("new")
+	f.Abort()
+
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("ファイルの内容 = %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("一時ファイルが残っている: %v", entries)
+	}
+}
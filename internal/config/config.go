@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/solidcopy/utag/internal/normalize"
+)
+
+// 設定ファイルとコマンドライン引数(--key=value)で指定できる設定。
+type Config struct {
+	// エクスポート
+	// 音声ストリームの情報の出力先。空、comment、reportのいずれか
+	ExportStreamInfo string
+	// アルバムアーティストがなく曲ごとのアーティストが異なる場合に、
+	// コンピレーションとして設定するアルバムアーティスト。空なら判定しない
+	ExportCompilationArtist string
+	// インポート
+	// 音声データのハッシュをタグに記録する
+	ImportAudioHash bool
+	// タグの後に確保する余白のバイト数。余白に収まれば次回からタグの部分だけを書き換える
+	ImportPadding int
+	// MP3とDSFに書き込むID3v2のバージョン。3か4
+	ID3v2Version int
+	// MP3の末尾にID3v1.1タグも書き込む
+	ID3v1 bool
+	// 複数のアーティストを1つの表示用のアーティスト名にする時の区切り
+	ArtistSeparator string
+	// アルバムアーティストを曲ごとのアーティストにも加える。コンピレーションでは加えない。
+	// v1.0.0の動作に合わせてデフォルトはtrue
+	MergeAlbumArtist bool
+	// リネーム
+	RenameASCII bool
+	// 正規化
+	NormalizeExport normalize.Rules
+	NormalizeImport normalize.Rules
+	// 書き換えルール
+	RewriteFile   string
+	RewriteExport bool
+	RewriteImport bool
+	// ゲストのアーティスト
+	FeatExport     bool
+	FeatMarkers    []string
+	FeatSeparators []string
+	// オフライン検索
+	LookupDatabase  string
+	LookupIndex     int
+	LookupTolerance time.Duration
+	// lookupとcで既存のtagsファイルを上書きする
+	Force bool
+}
+
+func Default() *Config {
+	conf := &Config{
+		ExportCompilationArtist: "Various Artists",
+		ImportPadding:           4096,
+		ID3v2Version:            4,
+		ArtistSeparator:         "; ",
+		MergeAlbumArtist:        true,
+		FeatMarkers:             []string{"feat.", "ft.", "featuring", "with"},
+		FeatSeparators:          []string{"&", "×"},
+		LookupTolerance:         3 * time.Second,
+	}
+
+	if configDir, err := os.UserConfigDir(); err == nil {
+		conf.RewriteFile = filepath.Join(configDir, "utag", "rules")
+	}
+
+	return conf
+}
+
+// ユーザー設定ディレクトリのutag/configを読み込む。
+// ファイルがなければデフォルトの設定を返す。
+func Load() (*Config, error) {
+	conf := Default()
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return conf, nil
+	}
+
+	configFile, err := os.Open(filepath.Join(configDir, "utag", "config"))
+	if os.IsNotExist(err) {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, errors.New("設定ファイルを読み込めませんでした。")
+	}
+	defer configFile.Close()
+
+	scanner := bufio.NewScanner(configFile)
+	scanner.Split(bufio.ScanLines)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("設定ファイルの%d行目が不正です。", lineNumber)
+		}
+
+		err = conf.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("設定ファイルの%d行目: %w", lineNumber, err)
+		}
+	}
+
+	return conf, nil
+}
+
+func (c *Config) Set(key string, value string) error {
+	switch key {
+	case "export.streaminfo":
+		if value != "" && value != "comment" && value != "report" {
+			return fmt.Errorf("%sにはcommentかreportを指定してください。", key)
+		}
+		c.ExportStreamInfo = value
+		return nil
+	case "export.compilationartist":
+		return setString(&c.ExportCompilationArtist, key, value)
+	case "import.audiohash":
+		return setBool(&c.ImportAudioHash, key, value)
+	case "import.padding":
+		return setInt(&c.ImportPadding, key, value)
+	case "id3v2.version":
+		if value != "3" && value != "4" {
+			return fmt.Errorf("%sには3か4を指定してください。", key)
+		}
+		c.ID3v2Version, _ = strconv.Atoi(value)
+		return nil
+	case "id3v1":
+		return setBool(&c.ID3v1, key, value)
+	case "artist.separator":
+		return setString(&c.ArtistSeparator, key, value)
+	case "artist.mergealbumartist":
+		return setBool(&c.MergeAlbumArtist, key, value)
+	case "rename.ascii":
+		return setBool(&c.RenameASCII, key, value)
+	case "normalize.export":
+		return setNormalizeRules(&c.NormalizeExport, value)
+	case "normalize.import":
+		return setNormalizeRules(&c.NormalizeImport, value)
+	case "rewrite.file":
+		c.RewriteFile = value
+		return nil
+	case "rewrite.export":
+		return setBool(&c.RewriteExport, key, value)
+	case "rewrite.import":
+		return setBool(&c.RewriteImport, key, value)
+	case "feat.export":
+		return setBool(&c.FeatExport, key, value)
+	case "feat.markers":
+		c.FeatMarkers = parseList(value)
+		return nil
+	case "feat.separators":
+		c.FeatSeparators = parseList(value)
+		return nil
+	case "lookup.db":
+		c.LookupDatabase = value
+		return nil
+	case "lookup.index":
+		return setInt(&c.LookupIndex, key, value)
+	case "lookup.tolerance":
+		return setSeconds(&c.LookupTolerance, key, value)
+	case "force":
+		return setBool(&c.Force, key, value)
+	default:
+		return fmt.Errorf("設定項目が不正です。 \"%s\"", key)
+	}
+}
+
+func setBool(field *bool, key string, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%sにはtrueかfalseを指定してください。", key)
+	}
+	*field = b
+	return nil
+}
+
+func setInt(field *int, key string, value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return fmt.Errorf("%sには0以上の整数を指定してください。", key)
+	}
+	*field = i
+	return nil
+}
+
+// 前後の空白を含めたい場合は"で囲む。
+func setString(field *string, key string, value string) error {
+	if strings.HasPrefix(value, "\"") {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%sの\"の囲み方が不正です。", key)
+		}
+		value = unquoted
+	}
+	*field = value
+	return nil
+}
+
+// 秒数(小数可)として解釈する。
+func setSeconds(field *time.Duration, key string, value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("%sには0以上の秒数を指定してください。", key)
+	}
+	*field = time.Duration(f * float64(time.Second))
+	return nil
+}
+
+// 空白区切りのリストとして解釈する。
+func parseList(value string) []string {
+	return strings.Fields(value)
+}
+
+func setNormalizeRules(field *normalize.Rules, value string) error {
+	rules, err := normalize.ParseRules(parseList(value))
+	if err != nil {
+		return err
+	}
+	*field = rules
+	return nil
+}
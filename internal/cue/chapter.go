@@ -0,0 +1,41 @@
+package cue
+
+import (
+	"math"
+	"time"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// 各トラックのINDEX 01を区切りにする。
+func ToChapters(sheet *Sheet) []model.Chapter {
+	chapters := []model.Chapter{}
+	for _, track := range sheet.Tracks {
+		frames, ok := track.Indexes[1]
+		if !ok {
+			continue
+		}
+		chapters = append(chapters, model.Chapter{
+			Start:     time.Duration(frames) * time.Second / FramesPerSecond,
+			Title:     track.Title,
+			Performer: track.Performer,
+		})
+	}
+	return chapters
+}
+
+// 1つのファイルの区切りからCUEシートを作成する。
+func FromChapters(chapters []model.Chapter, fileName string) *Sheet {
+	sheet := &Sheet{}
+	for i, chapter := range chapters {
+		frames := int(math.Round(chapter.Start.Seconds() * FramesPerSecond))
+		sheet.Tracks = append(sheet.Tracks, &Track{
+			Number:    i + 1,
+			Title:     chapter.Title,
+			Performer: chapter.Performer,
+			File:      fileName,
+			Indexes:   map[int]int{1: frames},
+		})
+	}
+	return sheet
+}
@@ -0,0 +1,299 @@
+package cue
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// CUEシートの1秒あたりのフレーム数
+const FramesPerSecond = 75
+
+// CUEシート。使う項目だけを読み込む。
+type Sheet struct {
+	Title      string
+	Performer  string
+	Date       string
+	Genre      string
+	DiscNumber int
+	TotalDiscs int
+	Tracks     []*Track
+}
+
+type Track struct {
+	Number    int
+	Title     string
+	Performer string
+	ISRC      string
+	// トラックが含まれるファイル名
+	File string
+	// インデックス番号ごとのファイル先頭からの位置(フレーム)
+	Indexes map[int]int
+}
+
+// CUEシートのファイルを読み込む。
+// UTF-8でなければShift_JISとみなす。
+func ReadFile(filePath string) (*Sheet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("CUEシートを読み込めませんでした。")
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		data, err = japanese.ShiftJIS.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, errors.New("CUEシートの文字コードが不正です。")
+		}
+	}
+
+	return Parse(string(data))
+}
+
+func Parse(text string) (*Sheet, error) {
+	sheet := &Sheet{}
+	var track *Track
+	file := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		fields := splitFields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.ToUpper(fields[0])
+		args := fields[1:]
+
+		// トラックより前ならアルバム、後ならトラックの項目
+		switch {
+		case command == "FILE" && len(args) >= 1:
+			file = args[0]
+		case command == "TRACK" && len(args) >= 1:
+			number, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("CUEシートの%d行目のトラック番号が不正です。", lineNumber)
+			}
+			track = &Track{Number: number, File: file, Indexes: map[int]int{}}
+			sheet.Tracks = append(sheet.Tracks, track)
+		case command == "INDEX" && len(args) >= 2 && track != nil:
+			number, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("CUEシートの%d行目のインデックス番号が不正です。", lineNumber)
+			}
+			frames, err := parseTime(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("CUEシートの%d行目の時間が不正です。", lineNumber)
+			}
+			track.Indexes[number] = frames
+		case command == "TITLE" && len(args) >= 1:
+			if track == nil {
+				sheet.Title = args[0]
+			} else {
+				track.Title = args[0]
+			}
+		case command == "PERFORMER" && len(args) >= 1:
+			if track == nil {
+				sheet.Performer = args[0]
+			} else {
+				track.Performer = args[0]
+			}
+		case command == "ISRC" && len(args) >= 1 && track != nil:
+			track.ISRC = args[0]
+		case command == "REM" && len(args) >= 2 && track == nil:
+			value := strings.Join(args[1:], " ")
+			switch strings.ToUpper(args[0]) {
+			case "DATE":
+				sheet.Date = value
+			case "GENRE":
+				sheet.Genre = value
+			case "DISCNUMBER":
+				sheet.DiscNumber, _ = strconv.Atoi(value)
+			case "TOTALDISCS":
+				sheet.TotalDiscs, _ = strconv.Atoi(value)
+			}
+		}
+	}
+
+	if len(sheet.Tracks) == 0 {
+		return nil, errors.New("CUEシートにトラックがありません。")
+	}
+
+	return sheet, nil
+}
+
+// CUEシートのファイルの内容のうち、ファイル名がoldNameのFILEの行だけファイル名をnewNameに書き換える。
+// 他の行は文字コードや改行も含めてそのまま残す。
+func RenameFile(data []byte, oldName string, newName string) ([]byte, error) {
+	sjis := !utf8.Valid(data)
+
+	renamed := []byte{}
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		text := string(line)
+		if sjis {
+			decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(line)
+			if err != nil {
+				return nil, errors.New("CUEシートの文字コードが不正です。")
+			}
+			text = string(decoded)
+		}
+
+		fields := splitFields(strings.TrimPrefix(text, "\ufeff"))
+		if len(fields) < 2 || strings.ToUpper(fields[0]) != "FILE" || fields[1] != oldName {
+			renamed = append(renamed, line...)
+			continue
+		}
+
+		newLine := replaceFileName(text, newName)
+		if sjis {
+			encoded, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(newLine))
+			if err != nil {
+				return nil, errors.New("ファイル名をCUEシートの文字コードに変換できません。")
+			}
+			newLine = string(encoded)
+		}
+		renamed = append(renamed, newLine...)
+	}
+
+	return renamed, nil
+}
+
+// FILEの行のファイル名の部分を置き換える。
+func replaceFileName(line string, newName string) string {
+	rest := strings.TrimLeft(line, "\ufeff \t")
+	rest = strings.TrimLeft(rest[len("FILE"):], " \t")
+	start := len(line) - len(rest)
+
+	// ファイル名の後の種類と改行は残す
+	end := -1
+	if strings.HasPrefix(rest, "\"") {
+		if i := strings.IndexByte(rest[1:], '"'); i >= 0 {
+			end = i + 2
+		}
+	} else {
+		end = strings.IndexAny(rest, " \t\r\n")
+	}
+	if end < 0 {
+		end = len(strings.TrimRight(rest, "\r\n"))
+	}
+
+	return line[:start] + quote(newName) + rest[end:]
+}
+
+// 空白区切りで分割する。"で囲まれた部分は空白を含めて1つの値とする。
+func splitFields(line string) []string {
+	fields := []string{}
+	line = strings.TrimSpace(line)
+
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				fields = append(fields, line[1:])
+				break
+			}
+			fields = append(fields, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			fields = append(fields, line)
+			break
+		}
+		fields = append(fields, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+
+	return fields
+}
+
+// mm:ss:ff(分:秒:フレーム)の形式の時間をフレーム数にする。
+func parseTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.New("時間の形式が不正です。")
+	}
+
+	values := [3]int{}
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, err
+		}
+		values[i] = value
+	}
+
+	return (values[0]*60+values[1])*FramesPerSecond + values[2], nil
+}
+
+// CUEシートの文字列を作成する。
+// 書き出すのは読み込む項目だけ。
+func Format(sheet *Sheet) string {
+	b := new(strings.Builder)
+
+	if sheet.Genre != "" {
+		fmt.Fprintf(b, "REM GENRE %s\n", quote(sheet.Genre))
+	}
+	if sheet.Date != "" {
+		fmt.Fprintf(b, "REM DATE %s\n", sheet.Date)
+	}
+	if sheet.DiscNumber != 0 {
+		fmt.Fprintf(b, "REM DISCNUMBER %d\n", sheet.DiscNumber)
+	}
+	if sheet.TotalDiscs != 0 {
+		fmt.Fprintf(b, "REM TOTALDISCS %d\n", sheet.TotalDiscs)
+	}
+	if sheet.Performer != "" {
+		fmt.Fprintf(b, "PERFORMER %s\n", quote(sheet.Performer))
+	}
+	if sheet.Title != "" {
+		fmt.Fprintf(b, "TITLE %s\n", quote(sheet.Title))
+	}
+
+	file := ""
+	for i, track := range sheet.Tracks {
+		if i == 0 || track.File != file {
+			file = track.File
+			fmt.Fprintf(b, "FILE %s WAVE\n", quote(file))
+		}
+
+		fmt.Fprintf(b, "  TRACK %02d AUDIO\n", track.Number)
+		if track.Title != "" {
+			fmt.Fprintf(b, "    TITLE %s\n", quote(track.Title))
+		}
+		if track.Performer != "" {
+			fmt.Fprintf(b, "    PERFORMER %s\n", quote(track.Performer))
+		}
+		if track.ISRC != "" {
+			fmt.Fprintf(b, "    ISRC %s\n", track.ISRC)
+		}
+		for _, number := range []int{0, 1} {
+			if frames, ok := track.Indexes[number]; ok {
+				fmt.Fprintf(b, "    INDEX %02d %s\n", number, formatTime(frames))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// CUEシートには"をエスケープする方法がないので'に置き換える。
+func quote(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "'") + "\""
+}
+
+func formatTime(frames int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", frames/FramesPerSecond/60, frames/FramesPerSecond%60, frames%FramesPerSecond)
+}
@@ -0,0 +1,110 @@
+package feat
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+// タイトルに書かれた「feat. X & Y」のようなゲストをアーティストとして取り出す。
+type Extractor struct {
+	pattern   *regexp.Regexp
+	separator *regexp.Regexp
+}
+
+// markersはゲストの前に書かれる語(feat.など)、separatorsは複数のゲストの区切り(&など)。
+func NewExtractor(markers []string, separators []string) *Extractor {
+	if len(markers) == 0 {
+		return &Extractor{}
+	}
+
+	bracketed := []string{}
+	trailing := []string{}
+	for _, marker := range markers {
+		quoted := regexp.QuoteMeta(marker)
+		if strings.HasSuffix(marker, ".") {
+			// 略語は括弧がなくても末尾にあればゲストとみなす
+			bracketed = append(bracketed, quoted+`\s*`)
+			trailing = append(trailing, quoted+`\s*`)
+		} else {
+			// withなどの単語は曲名の一部のことがあるので括弧内にある場合だけにする
+			bracketed = append(bracketed, quoted+`\s+`)
+		}
+	}
+
+	expr := `\s*[(\[（［]\s*(?:` + strings.Join(bracketed, "|") + `)(.+?)\s*[)\]）］]`
+	if len(trailing) > 0 {
+		expr += `|\s+(?:` + strings.Join(trailing, "|") + `)(.+)$`
+	}
+
+	extractor := &Extractor{pattern: regexp.MustCompile(`(?i)` + expr)}
+
+	if len(separators) > 0 {
+		quotedSeparators := []string{}
+		for _, separator := range separators {
+			quoted := regexp.QuoteMeta(separator)
+			if isWord(separator) {
+				quoted = `\s` + quoted + `\s`
+			}
+			quotedSeparators = append(quotedSeparators, quoted)
+		}
+		extractor.separator = regexp.MustCompile(`(?i)\s*(?:` + strings.Join(quotedSeparators, "|") + `)\s*`)
+	}
+
+	return extractor
+}
+
+// タイトルからゲストを取り除き、アーティストに追加する。
+func (e *Extractor) Track(track *model.Track) {
+	if e.pattern == nil {
+		return
+	}
+
+	guests := []string{}
+	for _, match := range e.pattern.FindAllStringSubmatch(track.Title, -1) {
+		for _, group := range match[1:] {
+			if group != "" {
+				guests = append(guests, e.split(group)...)
+			}
+		}
+	}
+
+	if len(guests) == 0 {
+		return
+	}
+
+	track.Title = strings.TrimSpace(e.pattern.ReplaceAllString(track.Title, ""))
+
+	for _, guest := range guests {
+		if !slices.Contains(track.Artists, guest) {
+			track.Artists = append(track.Artists, guest)
+		}
+	}
+}
+
+func (e *Extractor) split(s string) []string {
+	values := []string{s}
+	if e.separator != nil {
+		values = e.separator.Split(s, -1)
+	}
+
+	guests := []string{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			guests = append(guests, value)
+		}
+	}
+	return guests
+}
+
+func isWord(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
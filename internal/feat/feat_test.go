@@ -0,0 +1,86 @@
+package feat
+
+import (
+	"testing"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+func TestTrack(t *testing.T) {
+	markers := []string{"feat.", "ft.", "featuring", "with"}
+	separators := []string{"&", "×", ",", "、", "and"}
+
+	tests := []struct {
+		name        string
+		markers     []string
+		title       string
+		wantTitle   string
+		wantArtists []string
+	}{
+		{"括弧内", markers, "Song (feat. B)", "Song", []string{"A", "B"}},
+		{"全角の括弧", markers, "Song （feat. Ｂ）", "Song", []string{"A", "Ｂ"}},
+		{"大文字と小文字を区別しない", markers, "Song [Featuring B, C]", "Song", []string{"A", "B", "C"}},
+		{"略語は末尾にあれば括弧がなくてもよい", markers, "Song feat. B & C", "Song", []string{"A", "B", "C"}},
+		{"略語の後の空白は省略できる", markers, "Song ft.B×C", "Song", []string{"A", "B", "C"}},
+		{"単語は括弧内だけ", markers, "Song (with B)", "Song", []string{"A", "B"}},
+		{"括弧のない単語は曲名の一部", markers, "Walk with Me", "Walk with Me", []string{"A"}},
+		{"単語の区切りは前後に空白が必要", markers, "Song (feat. Brandon and C)", "Song", []string{"A", "Brandon", "C"}},
+		{"既にいるアーティストは追加しない", markers, "Song (feat. A) feat. B", "Song", []string{"A", "B"}},
+		{"ゲストがいない", markers, "Song (Remix)", "Song (Remix)", []string{"A"}},
+		{"ゲストの前の語がなければ何もしない", nil, "Song (feat. B)", "Song (feat. B)", []string{"A"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &model.Track{Title: tt.title, Artists: []string{"A"}}
+			NewExtractor(tt.markers, separators).Track(track)
+
+			if track.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", track.Title, tt.wantTitle)
+			}
+			if !slices.Equal(track.Artists, tt.wantArtists) {
+				t.Errorf("Artists = %q, want %q", track.Artists, tt.wantArtists)
+			}
+		})
+	}
+}
+
+func TestTrackWithoutSeparators(t *testing.T) {
+	track := &model.Track{Title: "Song (feat. B & C)"}
+	NewExtractor([]string{"feat."}, nil).Track(track)
+
+	if track.Title != "Song" || !slices.Equal(track.Artists, []string{"B & C"}) {
+		t.Errorf("Title = %q, Artists = %q", track.Title, track.Artists)
+	}
+}
+
+func TestTrackWithDefaultConfig(t *testing.T) {
+	conf := config.Default()
+	extractor := NewExtractor(conf.FeatMarkers, conf.FeatSeparators)
+
+	tests := []struct {
+		name        string
+		title       string
+		wantArtists []string
+	}{
+		{"&で分割する", "Song (feat. B & C)", []string{"A", "B", "C"}},
+		{"×で分割する", "Song (with B×C)", []string{"A", "B", "C"}},
+		{",では分割しない", "Song (feat. Tyler, The Creator)", []string{"A", "Tyler, The Creator"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &model.Track{Title: tt.title, Artists: []string{"A"}}
+			extractor.Track(track)
+
+			if track.Title != "Song" {
+				t.Errorf("Title = %q", track.Title)
+			}
+			if !slices.Equal(track.Artists, tt.wantArtists) {
+				t.Errorf("Artists = %q, want %q", track.Artists, tt.wantArtists)
+			}
+		})
+	}
+}
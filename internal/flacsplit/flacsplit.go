@@ -0,0 +1,273 @@
+package flacsplit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/solidcopy/utag/internal/atomicfile"
+	"golang.org/x/exp/slices"
+)
+
+// メタデータブロックの種類
+const (
+	blockTypeStreamInfo = 0
+	blockTypeSeekTable  = 3
+	blockTypeCueSheet   = 5
+)
+
+// 分割元のFLACファイル。
+// オーディオデータはデコードせず、フレーム単位でそのまま書き出す。
+// メタデータとフレームの位置だけをメモリに持ち、フレームは書き出す時にファイルから読み込む。
+type File struct {
+	file *os.File
+	// STREAMINFOブロックの内容
+	streamInfo []byte
+	// STREAMINFO以外でコピーするメタデータブロック(ヘッダを含む)
+	blocks [][]byte
+	frames []frame
+}
+
+type frame struct {
+	offset int64
+	size   int
+	// ファイル先頭からのサンプル位置
+	sample int64
+	// フレーム番号の開始位置と終了位置
+	numberStart int
+	numberEnd   int
+	// CRC-8の位置
+	headerEnd int
+	// フレームのサンプル数
+	blockSize int
+	// 可変ブロックサイズならフレーム番号の代わりにサンプル位置を持つ
+	variable bool
+}
+
+// 分割元のファイルを開く。使い終わったらCloseで閉じる。
+func Open(filePath string) (*File, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := open(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func open(file *os.File) (*File, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	w := newWindow(file, stat.Size())
+
+	magic, err := w.at(0, 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(magic) != "fLaC" {
+		return nil, errors.New("FLACファイルの形式が不正です。")
+	}
+
+	f := &File{file: file}
+
+	offset := int64(4)
+	for {
+		header, err := w.at(offset, 4)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) < 4 {
+			return nil, errors.New("FLACファイルのメタデータが不正です。")
+		}
+
+		isLast := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		block, err := w.at(offset, 4+length)
+		if err != nil {
+			return nil, err
+		}
+		if len(block) < 4+length {
+			return nil, errors.New("FLACファイルのメタデータが不正です。")
+		}
+
+		switch blockType {
+		case blockTypeStreamInfo:
+			f.streamInfo = slices.Clone(block[4:])
+		case blockTypeSeekTable, blockTypeCueSheet:
+			// 分割すると位置が合わなくなるのでコピーしない
+		default:
+			f.blocks = append(f.blocks, slices.Clone(block))
+		}
+
+		offset += int64(4 + length)
+		if isLast {
+			break
+		}
+	}
+
+	if len(f.streamInfo) != 34 {
+		return nil, errors.New("FLACファイルのSTREAMINFOが不正です。")
+	}
+
+	f.frames, err = scanFrames(w, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+func (f *File) SampleRate() int {
+	return int(binary.BigEndian.Uint32(f.streamInfo[10:14]) >> 12)
+}
+
+func (f *File) TotalSamples() int64 {
+	last := f.frames[len(f.frames)-1]
+	return last.sample + int64(last.blockSize)
+}
+
+// [start, end)のサンプルを含むファイルを書き出す。
+// 分割位置はそれぞれ最も近いフレームの境界にずらす。
+// 一時ファイルに書き込んでから置き換えるので、途中で失敗してもfilePathのファイルは作成されない。
+func (f *File) WriteRange(filePath string, start int64, end int64) error {
+	first := f.nearestFrame(start)
+	last := f.nearestFrame(end)
+	if first >= last {
+		return errors.New("分割するトラックが短すぎます。")
+	}
+	frames := f.frames[first:last]
+
+	numbers := make([]int64, len(frames))
+	minFrameSize, maxFrameSize := 0, 0
+	for i, fr := range frames {
+		numbers[i] = int64(i)
+		if fr.variable {
+			numbers[i] = fr.sample - frames[0].sample
+		}
+
+		size := fr.size - (fr.numberEnd - fr.numberStart) + len(encodeNumber(numbers[i]))
+		if minFrameSize == 0 || size < minFrameSize {
+			minFrameSize = size
+		}
+		maxFrameSize = max(maxFrameSize, size)
+	}
+
+	newFile, err := atomicfile.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer newFile.Abort()
+
+	out := bufio.NewWriter(newFile)
+
+	header := []byte{blockTypeStreamInfo, 0, 0, byte(len(f.streamInfo))}
+	if len(f.blocks) == 0 {
+		header[0] |= 0x80
+	}
+	out.WriteString("fLaC")
+	out.Write(header)
+	out.Write(f.newStreamInfo(frames, minFrameSize, maxFrameSize))
+
+	for i, block := range f.blocks {
+		blockHeader := block[0] & 0x7F
+		if i == len(f.blocks)-1 {
+			blockHeader |= 0x80
+		}
+		out.WriteByte(blockHeader)
+		out.Write(block[1:])
+	}
+
+	buf := []byte{}
+	for i, fr := range frames {
+		if cap(buf) < fr.size {
+			buf = make([]byte, fr.size)
+		}
+		buf = buf[:fr.size]
+
+		_, err = f.file.ReadAt(buf, fr.offset)
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write(renumberFrame(buf, fr, numbers[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return err
+	}
+
+	return newFile.Commit()
+}
+
+// 分割後のSTREAMINFOを返す。
+// 最小・最大フレームサイズと総サンプル数を更新し、MD5は不明(0)にする。
+func (f *File) newStreamInfo(frames []frame, minFrameSize int, maxFrameSize int) []byte {
+	info := slices.Clone(f.streamInfo)
+
+	last := frames[len(frames)-1]
+	totalSamples := last.sample + int64(last.blockSize) - frames[0].sample
+
+	putUint24(info[4:7], minFrameSize)
+	putUint24(info[7:10], maxFrameSize)
+	packed := binary.BigEndian.Uint64(info[10:18])
+	packed = packed&^(1<<36-1) | uint64(totalSamples)&(1<<36-1)
+	binary.BigEndian.PutUint64(info[10:18], packed)
+	for i := 18; i < 34; i++ {
+		info[i] = 0
+	}
+
+	return info
+}
+
+func (f *File) nearestFrame(sample int64) int {
+	for i, fr := range f.frames {
+		if fr.sample >= sample {
+			if i > 0 && sample-f.frames[i-1].sample < fr.sample-sample {
+				return i - 1
+			}
+			return i
+		}
+	}
+
+	last := f.frames[len(f.frames)-1]
+	if sample-last.sample < last.sample+int64(last.blockSize)-sample {
+		return len(f.frames) - 1
+	}
+	return len(f.frames)
+}
+
+// フレーム番号を書き換え、CRCを計算し直したフレームを返す。
+func renumberFrame(src []byte, fr frame, number int64) []byte {
+	written := make([]byte, 0, fr.size+6)
+	written = append(written, src[:fr.numberStart]...)
+	written = append(written, encodeNumber(number)...)
+	written = append(written, src[fr.numberEnd:fr.headerEnd]...)
+	written = append(written, crc8(written))
+	written = append(written, src[fr.headerEnd+1:fr.size-2]...)
+
+	crc := crc16(written)
+	return append(written, byte(crc>>8), byte(crc))
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
@@ -0,0 +1,264 @@
+package flacsplit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/test.flacは44.1kHz、16bit、2chで、4096、4096、1000サンプルの3つのフレームからなる。
+const testFile = "testdata/test.flac"
+
+func TestOpen(t *testing.T) {
+	f, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got := f.SampleRate(); got != 44100 {
+		t.Errorf("SampleRate = %d", got)
+	}
+	if got := f.TotalSamples(); got != 4096*2+1000 {
+		t.Errorf("TotalSamples = %d", got)
+	}
+
+	wantSamples := []int64{0, 4096, 8192}
+	if len(f.frames) != len(wantSamples) {
+		t.Fatalf("フレーム数 = %d", len(f.frames))
+	}
+	for i, fr := range f.frames {
+		if fr.sample != wantSamples[i] {
+			t.Errorf("フレーム%dのサンプル位置 = %d, want %d", i, fr.sample, wantSamples[i])
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	data, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 最後のフレームのCRC-16を壊す
+	broken := bytes.Clone(data)
+	broken[len(broken)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"FLACでない", []byte("RIFF0000WAVE")},
+		{"メタデータが途中で切れている", data[:20]},
+		{"フレームが壊れている", broken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "test.flac")
+			err := os.WriteFile(filePath, tt.data, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := Open(filePath)
+			if err == nil {
+				f.Close()
+				t.Error("エラーにならない")
+			}
+		})
+	}
+}
+
+func TestWriteRange(t *testing.T) {
+	source, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	sourceData, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int64
+		// 書き出されるフレーム
+		frames []int
+	}{
+		{"最初のフレーム", 0, 4096, []int{0}},
+		{"境界の近くにずらす", 100, 9000, []int{0, 1, 2}},
+		{"途中から最後まで", 4096, source.TotalSamples(), []int{1, 2}},
+		{"最後のフレーム", 8000, source.TotalSamples(), []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "split.flac")
+			err := source.WriteRange(filePath, tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 書き出したファイルのフレームはCRCが正しくなければ読み込めない
+			split, err := Open(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer split.Close()
+
+			if len(split.frames) != len(tt.frames) {
+				t.Fatalf("フレーム数 = %d, want %d", len(split.frames), len(tt.frames))
+			}
+
+			totalSamples := int64(0)
+			minFrameSize, maxFrameSize := 0, 0
+			for i, fr := range split.frames {
+				sourceFrame := source.frames[tt.frames[i]]
+				totalSamples += int64(sourceFrame.blockSize)
+				if minFrameSize == 0 || fr.size < minFrameSize {
+					minFrameSize = fr.size
+				}
+				maxFrameSize = max(maxFrameSize, fr.size)
+
+				data := make([]byte, fr.size)
+				_, err = split.file.ReadAt(data, fr.offset)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// フレーム番号は0から振り直される
+				number := data[fr.numberStart:fr.numberEnd]
+				if want := encodeNumber(int64(i)); !bytes.Equal(number, want) {
+					t.Errorf("フレーム%dの番号 = %x, want %x", i, number, want)
+				}
+
+				// サブフレームは変わらない
+				sourceData := sourceData[sourceFrame.offset : sourceFrame.offset+int64(sourceFrame.size)]
+				if !bytes.Equal(data[fr.headerEnd+1:fr.size-2], sourceData[sourceFrame.headerEnd+1:sourceFrame.size-2]) {
+					t.Errorf("フレーム%dのデータが変わった", i)
+				}
+			}
+
+			if got := split.TotalSamples(); got != totalSamples {
+				t.Errorf("TotalSamples = %d, want %d", got, totalSamples)
+			}
+
+			info := split.streamInfo
+			if got := int(info[4])<<16 | int(info[5])<<8 | int(info[6]); got != minFrameSize {
+				t.Errorf("最小フレームサイズ = %d, want %d", got, minFrameSize)
+			}
+			if got := int(info[7])<<16 | int(info[8])<<8 | int(info[9]); got != maxFrameSize {
+				t.Errorf("最大フレームサイズ = %d, want %d", got, maxFrameSize)
+			}
+			if got := int64(binary.BigEndian.Uint64(info[10:18]) & (1<<36 - 1)); got != totalSamples {
+				t.Errorf("STREAMINFOの総サンプル数 = %d, want %d", got, totalSamples)
+			}
+			if !bytes.Equal(info[18:34], make([]byte, 16)) {
+				t.Errorf("MD5が0でない")
+			}
+		})
+	}
+}
+
+func TestWriteRangeTooShort(t *testing.T) {
+	source, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	filePath := filepath.Join(t.TempDir(), "split.flac")
+	err = source.WriteRange(filePath, 4096, 4100)
+	if err == nil {
+		t.Fatal("エラーにならない")
+	}
+
+	// 失敗したら何も作成しない
+	entries, _ := os.ReadDir(filepath.Dir(filePath))
+	if len(entries) != 0 {
+		t.Errorf("ファイルが残っている: %v", entries)
+	}
+}
+
+func TestEncodeNumber(t *testing.T) {
+	tests := []struct {
+		number int64
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0xc2, 0x80}},
+		{0x7ff, []byte{0xdf, 0xbf}},
+		{0x800, []byte{0xe0, 0xa0, 0x80}},
+		{0xffff, []byte{0xef, 0xbf, 0xbf}},
+		{0x10000, []byte{0xf0, 0x90, 0x80, 0x80}},
+		{1<<36 - 1, []byte{0xfe, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf}},
+	}
+
+	for _, tt := range tests {
+		got := encodeNumber(tt.number)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeNumber(%d) = %x, want %x", tt.number, got, tt.want)
+		}
+		if length := codedNumberLength(got[0]); length != len(got) {
+			t.Errorf("codedNumberLength(%x) = %d, want %d", got[0], length, len(got))
+		}
+	}
+}
+
+func TestCrc(t *testing.T) {
+	data := []byte("123456789")
+	if got := crc8(data); got != 0xf4 {
+		t.Errorf("crc8 = %#x", got)
+	}
+	if got := crc16(data); got != 0xfee8 {
+		t.Errorf("crc16 = %#x", got)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	data := make([]byte, windowSize*2+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	filePath := filepath.Join(t.TempDir(), "data")
+	err := os.WriteFile(filePath, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := newWindow(file, int64(len(data)))
+	tests := []struct {
+		pos  int64
+		n    int
+		want []byte
+	}{
+		{0, 10, data[:10]},
+		{windowSize - 2, 4, data[windowSize-2 : windowSize+2]},
+		{100, 20, data[100:120]},
+		{windowSize, windowSize + 50, data[windowSize : windowSize*2+50]},
+		{int64(len(data)) - 3, 10, data[len(data)-3:]},
+		{int64(len(data)), 10, []byte{}},
+	}
+
+	for _, tt := range tests {
+		got, err := w.at(tt.pos, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("at(%d, %d)のデータが違う", tt.pos, tt.n)
+		}
+	}
+}
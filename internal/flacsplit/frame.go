@@ -0,0 +1,235 @@
+package flacsplit
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// フレームのヘッダの最大のバイト数
+const maxFrameHeaderSize = 16
+
+// offset以降のオーディオデータをフレームに分ける。
+// フレームの終わりは次のフレームのヘッダとCRC-16が一致する位置とする。
+func scanFrames(w *window, offset int64) ([]frame, error) {
+	frames := []frame{}
+	var sample int64
+
+	for offset < w.size {
+		header, err := w.at(offset, maxFrameHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+
+		fr, ok := parseFrameHeader(header)
+		if !ok {
+			return nil, errors.New("FLACファイルのフレームが不正です。")
+		}
+
+		end, err := findFrameEnd(w, offset, fr.headerEnd+1)
+		if err != nil {
+			return nil, err
+		}
+		if end < 0 {
+			return nil, errors.New("FLACファイルのフレームが不正です。")
+		}
+
+		fr.offset = offset
+		fr.size = int(end - offset)
+		fr.sample = sample
+		frames = append(frames, fr)
+
+		sample += int64(fr.blockSize)
+		offset = end
+	}
+
+	if len(frames) == 0 {
+		return nil, errors.New("FLACファイルにオーディオデータがありません。")
+	}
+
+	return frames, nil
+}
+
+// ヘッダの各項目の位置とブロックサイズを読み取る。位置はフレーム先頭からの相対位置。
+func parseFrameHeader(header []byte) (frame, bool) {
+	if len(header) < 6 || header[0] != 0xFF || header[1]&0xFE != 0xF8 {
+		return frame{}, false
+	}
+
+	blockSizeCode := header[2] >> 4
+	sampleRateCode := header[2] & 0x0F
+	if blockSizeCode == 0 || sampleRateCode == 15 {
+		return frame{}, false
+	}
+
+	numberLength := codedNumberLength(header[4])
+	if numberLength == 0 {
+		return frame{}, false
+	}
+
+	pos := 4 + numberLength
+	switch blockSizeCode {
+	case 6:
+		pos++
+	case 7:
+		pos += 2
+	}
+	switch sampleRateCode {
+	case 12:
+		pos++
+	case 13, 14:
+		pos += 2
+	}
+
+	if pos >= len(header) || crc8(header[:pos]) != header[pos] {
+		return frame{}, false
+	}
+
+	return frame{
+		numberStart: 4,
+		numberEnd:   4 + numberLength,
+		headerEnd:   pos,
+		blockSize:   blockSize(header, 4+numberLength),
+		variable:    header[1]&0x01 != 0,
+	}, true
+}
+
+// フレームの終わりの位置を返す。見つからなければ-1を返す。
+func findFrameEnd(w *window, offset int64, headerSize int) (int64, error) {
+	header, err := w.at(offset, headerSize)
+	if err != nil {
+		return -1, err
+	}
+	crc := crc16(header)
+
+	for end := offset + int64(headerSize) + 2; end <= w.size; end++ {
+		tail, err := w.at(end-2, 2)
+		if err != nil {
+			return -1, err
+		}
+
+		if crc == binary.BigEndian.Uint16(tail) {
+			if end == w.size {
+				return end, nil
+			}
+
+			next, err := w.at(end, maxFrameHeaderSize)
+			if err != nil {
+				return -1, err
+			}
+			if _, ok := parseFrameHeader(next); ok {
+				return end, nil
+			}
+
+			tail, err = w.at(end-2, 2)
+			if err != nil {
+				return -1, err
+			}
+		}
+
+		crc = updateCrc16(crc, tail[0])
+	}
+
+	return -1, nil
+}
+
+// ヘッダのブロックサイズ(フレームのサンプル数)を返す。
+func blockSize(frameData []byte, numberEnd int) int {
+	code := frameData[2] >> 4
+	switch {
+	case code == 1:
+		return 192
+	case code <= 5:
+		return 576 << (code - 2)
+	case code == 6:
+		return int(frameData[numberEnd]) + 1
+	case code == 7:
+		return int(binary.BigEndian.Uint16(frameData[numberEnd:numberEnd+2])) + 1
+	default:
+		return 256 << (code - 8)
+	}
+}
+
+// フレーム番号(UTF-8と同様の可変長符号)のバイト数を返す。
+func codedNumberLength(first byte) int {
+	switch {
+	case first&0x80 == 0:
+		return 1
+	case first&0xE0 == 0xC0:
+		return 2
+	case first&0xF0 == 0xE0:
+		return 3
+	case first&0xF8 == 0xF0:
+		return 4
+	case first&0xFC == 0xF8:
+		return 5
+	case first&0xFE == 0xFC:
+		return 6
+	case first == 0xFE:
+		return 7
+	default:
+		return 0
+	}
+}
+
+func encodeNumber(number int64) []byte {
+	if number < 0x80 {
+		return []byte{byte(number)}
+	}
+
+	length := 2
+	for length < 7 && number >= 1<<(5*length+1) {
+		length++
+	}
+
+	encoded := make([]byte, length)
+	for i := length - 1; i > 0; i-- {
+		encoded[i] = 0x80 | byte(number&0x3F)
+		number >>= 6
+	}
+	encoded[0] = byte(0xFF<<(8-length)) | byte(number)
+
+	return encoded
+}
+
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+var crc16Table [256]uint16 = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = updateCrc16(crc, b)
+	}
+	return crc
+}
+
+func updateCrc16(crc uint16, b byte) uint16 {
+	return crc<<8 ^ crc16Table[byte(crc>>8)^b]
+}
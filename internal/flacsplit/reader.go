@@ -0,0 +1,44 @@
+package flacsplit
+
+import (
+	"io"
+	"os"
+)
+
+// ファイルを先頭から順に読み進めるためのバッファ。
+// フレームの区切りを探す時に、ファイル全体を読み込まずに少しずつ読み込む。
+type window struct {
+	file *os.File
+	size int64
+	// バッファの先頭のファイル上の位置
+	start int64
+	buf   []byte
+}
+
+// 一度に読み込むバイト数
+const windowSize = 1 << 20
+
+func newWindow(file *os.File, size int64) *window {
+	return &window{file: file, size: size}
+}
+
+// posからnバイトを返す。ファイルの終わりを超える部分は返さない。
+// 返したスライスは次の呼び出しまでしか有効でない。
+func (w *window) at(pos int64, n int) ([]byte, error) {
+	end := min(pos+int64(n), w.size)
+	if pos < w.start || end > w.start+int64(len(w.buf)) {
+		length := max(int64(windowSize), end-pos)
+		length = min(length, w.size-pos)
+		if cap(w.buf) < int(length) {
+			w.buf = make([]byte, length)
+		}
+		w.buf = w.buf[:length]
+
+		_, err := w.file.ReadAt(w.buf, pos)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		w.start = pos
+	}
+	return w.buf[pos-w.start : end-w.start], nil
+}
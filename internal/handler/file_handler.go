@@ -3,6 +3,7 @@ package handler
 import (
 	"path/filepath"
 
+	"github.com/solidcopy/utag/internal/config"
 	"github.com/solidcopy/utag/internal/handler/flac"
 	"github.com/solidcopy/utag/internal/handler/id3v2"
 	"github.com/solidcopy/utag/internal/handler/m4a"
@@ -11,7 +12,11 @@ import (
 
 type FileHandler interface {
 	ReadTrack(filePath string) (*model.Track, error)
-	WriteTrack(track *model.Track) error
+	WriteTrack(track *model.Track, conf *config.Config) error
+	// 音声データが壊れていないか確認する。問題があればその内容をエラーとして返す。
+	VerifyFile(filePath string) error
+	// タグを除いた音声データのハッシュを返す。
+	HashAudio(filePath string) (string, error)
 }
 
 func NewHandler(filePath string) (FileHandler, error) {
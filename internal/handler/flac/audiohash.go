@@ -0,0 +1,59 @@
+package flac
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// メタデータブロックの後のフレーム全体のSHA-256を返す。
+func (h *FlacHandler) HashAudio(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return hashAudio(io.NewSectionReader(file, 0, stat.Size()))
+}
+
+func hashAudio(file *io.SectionReader) (string, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(file, header)
+	if err != nil || string(header) != "fLaC" {
+		return "", errors.New("FLACファイルの形式が不正です。")
+	}
+
+	for {
+		_, err = io.ReadFull(file, header)
+		if err != nil {
+			return "", errors.New("FLACファイルのメタデータが不正です。")
+		}
+
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		_, err = file.Seek(length, io.SeekCurrent)
+		if err != nil {
+			return "", err
+		}
+
+		// 最後のメタデータブロック
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
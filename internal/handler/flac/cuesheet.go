@@ -0,0 +1,167 @@
+package flac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/solidcopy/utag/internal/cue"
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+// CUESHEETブロックの固定長部分のサイズ
+const (
+	cueSheetHeaderSize = 128 + 8 + 259 + 1
+	cueSheetTrackSize  = 8 + 1 + 12 + 14 + 1
+	cueSheetIndexSize  = 8 + 1 + 3
+)
+
+// CDでないCUESHEETのリードアウトのトラック番号
+const leadOutTrackNumber = 255
+
+// CUESHEETブロックに書き込める区切りの最大数。トラック番号は1バイトで、255はリードアウトになる
+const maxCueSheetTracks = leadOutTrackNumber - 1
+
+// 埋め込まれたCUEシートから区切りを取得する。
+// CUESHEETコメントにCUEシートのテキストがあればそれを優先し、
+// なければCUESHEETブロックの位置とCUE_TRACKnn_TITLEなどのコメントを使う。
+func getChapters(blocks Blocks, comments map[string][]string, sampleRate int) []model.Chapter {
+	if text := getString(comments, "CUESHEET"); text != "" {
+		if sheet, err := cue.Parse(text); err == nil {
+			return cue.ToChapters(sheet)
+		}
+	}
+
+	if sampleRate == 0 {
+		return nil
+	}
+
+	for _, block := range blocks {
+		if block.Type != flac.CueSheet {
+			continue
+		}
+
+		chapters := []model.Chapter{}
+		for _, cueTrack := range parseCueSheetBlock(block.Data) {
+			prefix := fmt.Sprintf("CUE_TRACK%02d_", cueTrack.number)
+			chapters = append(chapters, model.Chapter{
+				Start:     time.Duration(float64(cueTrack.start) / float64(sampleRate) * float64(time.Second)),
+				Title:     getString(comments, prefix+"TITLE"),
+				Performer: getString(comments, prefix+"PERFORMER"),
+			})
+		}
+		return chapters
+	}
+
+	return nil
+}
+
+type cueSheetTrack struct {
+	number int
+	// INDEX 01の位置(サンプル)
+	start int64
+}
+
+func parseCueSheetBlock(data []byte) []cueSheetTrack {
+	if len(data) < cueSheetHeaderSize {
+		return nil
+	}
+
+	count := int(data[cueSheetHeaderSize-1])
+	pos := cueSheetHeaderSize
+
+	tracks := []cueSheetTrack{}
+	for i := 0; i < count; i++ {
+		if pos+cueSheetTrackSize > len(data) {
+			return tracks
+		}
+
+		offset := int64(binary.BigEndian.Uint64(data[pos : pos+8]))
+		number := int(data[pos+8])
+		indexCount := int(data[pos+cueSheetTrackSize-1])
+		pos += cueSheetTrackSize
+
+		start := offset
+		for j := 0; j < indexCount && pos+cueSheetIndexSize <= len(data); j++ {
+			if data[pos+8] == 1 {
+				start = offset + int64(binary.BigEndian.Uint64(data[pos:pos+8]))
+			}
+			pos += cueSheetIndexSize
+		}
+
+		// リードアウトは区切りではない
+		if number == 170 || number == leadOutTrackNumber {
+			continue
+		}
+
+		tracks = append(tracks, cueSheetTrack{number: number, start: start})
+	}
+
+	return tracks
+}
+
+// 区切りからCDでないCUESHEETブロックを作成する。
+// 各トラックはINDEX 01だけを持ち、最後にリードアウトを置く。
+func newCueSheetBlock(chapters []model.Chapter, sampleRate int, totalSamples int64) (*flac.MetaDataBlock, error) {
+	if len(chapters) > maxCueSheetTracks {
+		return nil, fmt.Errorf("区切りが%d個を超えるので、CUESHEETブロックに書き込めません。", maxCueSheetTracks)
+	}
+
+	data := make([]byte, cueSheetHeaderSize)
+	data[cueSheetHeaderSize-1] = byte(len(chapters) + 1)
+
+	for i, chapter := range chapters {
+		track := make([]byte, cueSheetTrackSize+cueSheetIndexSize)
+		offset := int64(chapter.Start.Seconds() * float64(sampleRate))
+		binary.BigEndian.PutUint64(track[0:8], uint64(offset))
+		track[8] = byte(i + 1)
+		track[cueSheetTrackSize-1] = 1
+		track[cueSheetTrackSize+8] = 1
+		data = append(data, track...)
+	}
+
+	leadOut := make([]byte, cueSheetTrackSize)
+	binary.BigEndian.PutUint64(leadOut[0:8], uint64(totalSamples))
+	leadOut[8] = leadOutTrackNumber
+	data = append(data, leadOut...)
+
+	return &flac.MetaDataBlock{Type: flac.CueSheet, Data: data}, nil
+}
+
+// 区切りのタイトルとアーティストをCUE_TRACKnn_TITLEなどのコメントに設定する。
+// 既存のコメントにCUESHEETがあれば、区切りから作成したCUEシートで置き換える。
+func setChapterComments(vorbisComment *flacvorbis.MetaDataBlockVorbisComment, chapters []model.Chapter, comments map[string][]string, fileName string) {
+	if getString(comments, "CUESHEET") != "" && len(chapters) > 0 {
+		vorbisComment.Add("CUESHEET", cue.Format(cue.FromChapters(chapters, fileName)))
+	}
+
+	for i, chapter := range chapters {
+		prefix := fmt.Sprintf("CUE_TRACK%02d_", i+1)
+		setString(vorbisComment, prefix+"TITLE", chapter.Title)
+		setString(vorbisComment, prefix+"PERFORMER", chapter.Performer)
+	}
+}
+
+// 既存のCUESHEETとCUE_TRACKnn_TITLEなどのコメントをそのまま設定する。
+func copyChapterComments(vorbisComment *flacvorbis.MetaDataBlockVorbisComment, comments map[string][]string) {
+	names := []string{}
+	for name := range comments {
+		if name == "CUESHEET" || isChapterComment(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		setStrings(vorbisComment, name, comments[name])
+	}
+}
+
+// CUE_TRACKnn_TITLEなどの区切りのコメントならtrueを返す。
+func isChapterComment(name string) bool {
+	return strings.HasPrefix(name, "CUE_TRACK")
+}
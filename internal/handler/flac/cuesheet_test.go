@@ -0,0 +1,184 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-flac/go-flac"
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+func TestNewCueSheetBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		chapters []model.Chapter
+		want     []cueSheetTrack
+	}{
+		{
+			name:     "1つ",
+			chapters: []model.Chapter{{Start: 0}},
+			want:     []cueSheetTrack{{number: 1, start: 0}},
+		},
+		{
+			name:     "複数",
+			chapters: []model.Chapter{{Start: 0}, {Start: 1500 * time.Millisecond}, {Start: 3 * time.Second}},
+			want:     []cueSheetTrack{{number: 1, start: 0}, {number: 2, start: 66150}, {number: 3, start: 132300}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := newCueSheetBlock(tt.chapters, 44100, 44100*10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.Type != flac.CueSheet {
+				t.Errorf("Type = %v", block.Type)
+			}
+
+			// リードアウトを含むトラック数
+			if count := int(block.Data[cueSheetHeaderSize-1]); count != len(tt.chapters)+1 {
+				t.Errorf("トラック数 = %d, want %d", count, len(tt.chapters)+1)
+			}
+
+			got := parseCueSheetBlock(block.Data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("トラック%d = %v, want %v", i+1, got[i], tt.want[i])
+				}
+			}
+
+			// リードアウトの位置は総サンプル数
+			leadOut := block.Data[len(block.Data)-cueSheetTrackSize:]
+			if offset := binary.BigEndian.Uint64(leadOut); offset != 44100*10 || leadOut[8] != leadOutTrackNumber {
+				t.Errorf("リードアウト = %d %d", offset, leadOut[8])
+			}
+		})
+	}
+}
+
+func TestNewCueSheetBlockTooManyChapters(t *testing.T) {
+	chapters := make([]model.Chapter, maxCueSheetTracks)
+	if _, err := newCueSheetBlock(chapters, 44100, 44100); err != nil {
+		t.Errorf("%d個の区切りでエラー: %v", maxCueSheetTracks, err)
+	}
+
+	chapters = append(chapters, model.Chapter{})
+	if _, err := newCueSheetBlock(chapters, 44100, 44100); err == nil {
+		t.Errorf("%d個の区切りでエラーにならない", len(chapters))
+	}
+}
+
+// CDのCUESHEETブロック。カタログ番号、リードイン、ISRC、INDEX 00を持つ。
+func newCDCueSheetData() []byte {
+	data := make([]byte, cueSheetHeaderSize)
+	copy(data, "4988001234567")
+	binary.BigEndian.PutUint64(data[128:], 88200)
+	data[136] = 0x80
+	data[cueSheetHeaderSize-1] = 2
+
+	track := make([]byte, cueSheetTrackSize+cueSheetIndexSize*2)
+	track[8] = 1
+	copy(track[9:], "JPX001234567")
+	track[cueSheetTrackSize-1] = 2
+	index := track[cueSheetTrackSize:]
+	index[8] = 0
+	binary.BigEndian.PutUint64(index[cueSheetIndexSize:], 588)
+	index[cueSheetIndexSize+8] = 1
+	data = append(data, track...)
+
+	leadOut := make([]byte, cueSheetTrackSize)
+	binary.BigEndian.PutUint64(leadOut, 8820)
+	leadOut[8] = 170
+	return append(data, leadOut...)
+}
+
+func copyTestFile(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "test.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(t.TempDir(), "test.flac")
+	err = os.WriteFile(filePath, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func findCueSheetBlock(t *testing.T, filePath string) []byte {
+	t.Helper()
+
+	flacFile, err := flac.ParseFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range flacFile.Meta {
+		if block.Type == flac.CueSheet {
+			return block.Data
+		}
+	}
+	return nil
+}
+
+func TestWriteTrackCueSheet(t *testing.T) {
+	filePath := copyTestFile(t)
+
+	flacFile, err := flac.ParseFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdCueSheet := newCDCueSheetData()
+	flacFile.Meta = append(flacFile.Meta, &flac.MetaDataBlock{Type: flac.CueSheet, Data: cdCueSheet})
+	err = flacFile.Save(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &FlacHandler{}
+	conf := config.Default()
+
+	// 区切りを読み込んでいなければ既存のCUESHEETブロックをそのまま残す
+	track := &model.Track{FilePath: filePath, Title: "title"}
+	err = h.WriteTrack(track, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := findCueSheetBlock(t, filePath); !bytes.Equal(got, cdCueSheet) {
+		t.Errorf("CUESHEETブロックが変わった")
+	}
+
+	// 区切りを読み込んでいれば書き直す
+	track.Chapters = []model.Chapter{{Start: 0, Title: "a"}, {Start: 100 * time.Millisecond, Title: "b"}}
+	err = h.WriteTrack(track, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := h.ReadTrack(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Chapters) != 2 || read.Chapters[1].Start != 100*time.Millisecond || read.Chapters[1].Title != "b" {
+		t.Errorf("Chapters = %v", read.Chapters)
+	}
+
+	// 空の区切りを読み込んでいればCUESHEETブロックを削除する
+	track.Chapters = []model.Chapter{}
+	err = h.WriteTrack(track, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := findCueSheetBlock(t, filePath); got != nil {
+		t.Errorf("CUESHEETブロックが残っている")
+	}
+}
@@ -1,15 +1,23 @@
 package flac
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-flac/flacpicture"
 	"github.com/go-flac/flacvorbis"
 	"github.com/go-flac/go-flac"
 	utag "github.com/solidcopy/utag/internal"
+	"github.com/solidcopy/utag/internal/atomicfile"
+	"github.com/solidcopy/utag/internal/config"
 	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type FlacHandler struct {
@@ -25,43 +33,139 @@ func (h *FlacHandler) ReadTrack(filePath string) (*model.Track, error) {
 
 	blocks := flacFile.Meta
 	comments := getVorbisComments(blocks)
+	streamInfo := getStreamInfo(flacFile)
 
 	track := &model.Track{
-		FilePath:    filePath,
-		Album:       getString(comments, "ALBUM"),
-		AlbumArtist: getString(comments, "ALBUMARTIST"),
-		Date:        getString(comments, "DATE"),
-		Image:       getImage(blocks),
-		DiscNumber:  getInt(comments, "DISCNUMBER"),
-		TotalDiscs:  getInt(comments, "DISCTOTAL"),
-		TrackNumber: getInt(comments, "TRACKNUMBER"),
-		TotalTracks: getInt(comments, "TRACKTOTAL"),
-		Title:       getString(comments, "TITLE"),
-		Artists:     getValues(comments, "ARTIST"),
+		FilePath:        filePath,
+		Album:           getString(comments, "ALBUM"),
+		AlbumArtist:     getString(comments, "ALBUMARTIST"),
+		Compilation:     getString(comments, "COMPILATION") == "1",
+		OriginalDate:    getString(comments, "ORIGINALDATE"),
+		Image:           getImage(blocks),
+		AlbumSort:       getString(comments, "ALBUMSORT"),
+		AlbumArtistSort: getString(comments, "ALBUMARTISTSORT"),
+		DiscNumber:      getInt(comments, "DISCNUMBER"),
+		TotalDiscs:      getInt(comments, "DISCTOTAL"),
+		TrackNumber:     getInt(comments, "TRACKNUMBER"),
+		TotalTracks:     getInt(comments, "TRACKTOTAL"),
+		Title:           getString(comments, "TITLE"),
+		Artists:         getArtists(comments),
+		Genres:          getValues(comments, "GENRE"),
+		TitleSort:       getString(comments, "TITLESORT"),
+		ArtistSort:      getString(comments, "ARTISTSORT"),
+
+		MusicBrainzAlbumID:        getString(comments, "MUSICBRAINZ_ALBUMID"),
+		MusicBrainzReleaseGroupID: getString(comments, "MUSICBRAINZ_RELEASEGROUPID"),
+		MusicBrainzAlbumArtistIDs: getValues(comments, "MUSICBRAINZ_ALBUMARTISTID"),
+		MusicBrainzTrackID:        getString(comments, "MUSICBRAINZ_TRACKID"),
+		MusicBrainzReleaseTrackID: getString(comments, "MUSICBRAINZ_RELEASETRACKID"),
+		MusicBrainzArtistIDs:      getValues(comments, "MUSICBRAINZ_ARTISTID"),
+
+		AudioHash: getString(comments, "UTAG_AUDIO_SHA256"),
+		Custom:    getCustomComments(comments),
+
+		Chapters: getChapters(blocks, comments, getSampleRate(flacFile)),
+		Stream:   streamInfo,
 	}
 
+	// DATEは録音日(なければ発売日)、RELEASEDATEは録音日と異なる発売日
+	track.SetDates(getString(comments, "DATE"), getString(comments, "RELEASEDATE"))
+
 	return track, nil
 }
 
-func (h *FlacHandler) WriteTrack(track *model.Track) error {
-	flacFile, err := flac.ParseFile(track.FilePath)
+func (h *FlacHandler) WriteTrack(track *model.Track, conf *config.Config) error {
+	file, err := os.Open(track.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	flacFile, err := flac.ParseMetadata(file)
+	if err != nil {
+		return err
+	}
+
+	// メタデータブロックの後から音声データが始まる
+	audioStart, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := stat.Size()
+
+	// 書き込んだ後の音声データのハッシュを、置き換えや上書きの前に元のハッシュと比較する
+	audioHash, err := hashAudio(io.NewSectionReader(file, 0, fileSize))
 	if err != nil {
 		return err
 	}
 
-	blocks := removeVorbisCommentsAndPicture(flacFile.Meta)
+	// 区切りが読み込まれていなければ、既存のCUESHEETブロックとCUEシートのコメントをそのまま残す
+	keepCueSheet := track.Chapters == nil
+	comments := getVorbisComments(flacFile.Meta)
 
-	flacFile.Meta, err = addVorbisCommentsAndPicture(blocks, track)
+	blocks := removeTagBlocks(flacFile.Meta, keepCueSheet)
+
+	blocks, err = addTagBlocks(blocks, track, comments, flacFile, conf)
 	if err != nil {
 		return err
 	}
 
-	err = flacFile.Save(track.FilePath)
+	// 既存のメタデータブロックの領域に収まれば、音声データはそのままで残りを余白にする
+	size := int64(4)
+	for _, block := range blocks {
+		size += 4 + int64(len(block.Data))
+	}
+	if size == audioStart || size+4 <= audioStart && audioStart-size-4 <= maxBlockSize {
+		flacFile.Meta = blocks
+		if size != audioStart {
+			flacFile.Meta = append(blocks, newPaddingBlock(int(audioStart-size-4)))
+		}
+		data := flacFile.Marshal()
+
+		err = atomicfile.CheckHash(atomicfile.Patch(file, fileSize, data, 0), hashAudio, audioHash)
+		if err != nil {
+			return err
+		}
+		return atomicfile.WriteAt(track.FilePath, data, 0)
+	}
+
+	flacFile.Meta = append(blocks, newPaddingBlock(min(conf.ImportPadding, maxBlockSize)))
+
+	// 元のファイルは変更せず、一時ファイルに書き込んでから置き換える
+	newFile, err := atomicfile.Create(track.FilePath)
+	if err != nil {
+		return err
+	}
+	defer newFile.Abort()
+
+	_, err = newFile.Write(flacFile.Marshal())
+	if err != nil {
+		return err
+	}
+
+	// 読み込み位置は音声データの先頭にある
+	_, err = io.Copy(newFile, file)
+	if err != nil {
+		return err
+	}
+
+	file.Close()
+
+	content, err := newFile.Content()
+	if err != nil {
+		return err
+	}
+	err = atomicfile.CheckHash(content, hashAudio, audioHash)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return newFile.Commit()
 }
 
 func getVorbisComments(blocks Blocks) map[string][]string {
@@ -95,6 +199,14 @@ func getVorbisComments(blocks Blocks) map[string][]string {
 	return map[string][]string{}
 }
 
+// アーティストをARTISTSから読み込む。なければARTISTを読み込む。
+func getArtists(comments map[string][]string) []string {
+	if artists := getValues(comments, "ARTISTS"); len(artists) > 0 {
+		return artists
+	}
+	return getValues(comments, "ARTIST")
+}
+
 func getValues(comments map[string][]string, commentName string) []string {
 	values, ok := comments[commentName]
 	if !ok {
@@ -119,6 +231,61 @@ func getInt(comments map[string][]string, commentName string) int {
 	return value
 }
 
+// 決まった項目として読み書きするコメントの名前
+var knownComments = []string{
+	"ALBUM", "ALBUMARTIST", "COMPILATION", "DATE", "DISCNUMBER", "DISCTOTAL", "TRACKNUMBER", "TRACKTOTAL", "TITLE", "ARTIST",
+	"ARTISTS", "GENRE", "RELEASEDATE", "ORIGINALDATE", "ALBUMSORT", "ALBUMARTISTSORT", "TITLESORT", "ARTISTSORT",
+	"MUSICBRAINZ_ALBUMID", "MUSICBRAINZ_RELEASEGROUPID", "MUSICBRAINZ_ALBUMARTISTID",
+	"MUSICBRAINZ_TRACKID", "MUSICBRAINZ_RELEASETRACKID", "MUSICBRAINZ_ARTISTID",
+	"UTAG_AUDIO_SHA256", "CUESHEET",
+}
+
+// 決まった項目と区切りのコメント以外を返す。
+func getCustomComments(comments map[string][]string) map[string][]string {
+	var custom map[string][]string
+	for name, values := range comments {
+		if slices.Contains(knownComments, name) || isChapterComment(name) {
+			continue
+		}
+		if custom == nil {
+			custom = map[string][]string{}
+		}
+		custom[name] = values
+	}
+	return custom
+}
+
+func getStreamInfo(flacFile *flac.File) model.StreamInfo {
+	streamInfo, err := flacFile.GetStreamInfo()
+	if err != nil || streamInfo.SampleRate == 0 {
+		return model.StreamInfo{}
+	}
+
+	duration := time.Duration(float64(streamInfo.SampleCount) / float64(streamInfo.SampleRate) * float64(time.Second))
+
+	bitrate := 0
+	if duration > 0 {
+		bitrate = int(float64(len(flacFile.Frames)*8) / duration.Seconds())
+	}
+
+	return model.StreamInfo{
+		Duration:   duration,
+		Codec:      "FLAC",
+		SampleRate: streamInfo.SampleRate,
+		BitDepth:   streamInfo.BitDepth,
+		Channels:   streamInfo.ChannelCount,
+		Bitrate:    bitrate,
+	}
+}
+
+func getSampleRate(flacFile *flac.File) int {
+	streamInfo, err := flacFile.GetStreamInfo()
+	if err != nil {
+		return 0
+	}
+	return streamInfo.SampleRate
+}
+
 func getImage(blocks Blocks) *model.Image {
 	var picture *flacpicture.MetadataBlockPicture
 	for _, block := range blocks {
@@ -148,17 +315,23 @@ func getImage(blocks Blocks) *model.Image {
 	return &model.Image{MimeType: mimeType, Data: picture.ImageData}
 }
 
-func removeVorbisCommentsAndPicture(blocks Blocks) Blocks {
+// タグとして書き直すブロックを取り除く。
+// keepCueSheetがtrueならCUESHEETブロックは残す。
+func removeTagBlocks(blocks Blocks, keepCueSheet bool) Blocks {
 	newBlocks := Blocks{}
 	for _, block := range blocks {
-		if block.Type != flac.VorbisComment && block.Type != flac.Picture && block.Type != flac.Padding {
+		switch {
+		case block.Type == flac.VorbisComment, block.Type == flac.Picture, block.Type == flac.Padding:
+		case block.Type == flac.CueSheet && !keepCueSheet:
+		default:
 			newBlocks = append(newBlocks, block)
 		}
 	}
 	return newBlocks
 }
 
-func addVorbisCommentsAndPicture(blocks Blocks, track *model.Track) (Blocks, error) {
+// commentsは既存のVorbisコメント。区切りが読み込まれていなければ、CUEシートのコメントを引き継ぐ。
+func addTagBlocks(blocks Blocks, track *model.Track, comments map[string][]string, flacFile *flac.File, conf *config.Config) (Blocks, error) {
 
 	vorbisComment := flacvorbis.New()
 
@@ -166,20 +339,62 @@ func addVorbisCommentsAndPicture(blocks Blocks, track *model.Track) (Blocks, err
 
 	vorbisComment.Add("ALBUM", track.Album)
 	vorbisComment.Add("ALBUMARTIST", track.AlbumArtist)
-	vorbisComment.Add("DATE", track.Date)
+	if track.Compilation {
+		vorbisComment.Add("COMPILATION", "1")
+	}
+	vorbisComment.Add("DATE", track.DisplayDate())
+	if track.RecordingDate != "" {
+		setString(vorbisComment, "RELEASEDATE", track.Date)
+	}
+	setString(vorbisComment, "ORIGINALDATE", track.OriginalDate)
 	setInt(vorbisComment, "DISCNUMBER", track.DiscNumber)
 	setInt(vorbisComment, "DISCTOTAL", track.TotalDiscs)
 	setInt(vorbisComment, "TRACKNUMBER", track.TrackNumber)
 	setInt(vorbisComment, "TRACKTOTAL", track.TotalTracks)
 	vorbisComment.Add("TITLE", track.Title)
-	vorbisComment.Add("ARTIST", track.AlbumArtist)
-	for _, artist := range track.Artists {
-		vorbisComment.Add("ARTIST", artist)
+	// ARTISTには表示用のアーティスト名を設定し、複数のアーティストはARTISTSにも設定する
+	setString(vorbisComment, "ARTIST", track.DisplayArtist(conf.ArtistSeparator, conf.MergeAlbumArtist))
+	if artists := track.TagArtists(conf.MergeAlbumArtist); len(artists) > 1 {
+		setStrings(vorbisComment, "ARTISTS", artists)
+	}
+	setStrings(vorbisComment, "GENRE", track.Genres)
+	setString(vorbisComment, "ALBUMSORT", track.AlbumSort)
+	setString(vorbisComment, "ALBUMARTISTSORT", track.AlbumArtistSort)
+	setString(vorbisComment, "TITLESORT", track.TitleSort)
+	setString(vorbisComment, "ARTISTSORT", track.ArtistSort)
+
+	setString(vorbisComment, "MUSICBRAINZ_ALBUMID", track.MusicBrainzAlbumID)
+	setString(vorbisComment, "MUSICBRAINZ_RELEASEGROUPID", track.MusicBrainzReleaseGroupID)
+	setStrings(vorbisComment, "MUSICBRAINZ_ALBUMARTISTID", track.MusicBrainzAlbumArtistIDs)
+	setString(vorbisComment, "MUSICBRAINZ_TRACKID", track.MusicBrainzTrackID)
+	setString(vorbisComment, "MUSICBRAINZ_RELEASETRACKID", track.MusicBrainzReleaseTrackID)
+	setStrings(vorbisComment, "MUSICBRAINZ_ARTISTID", track.MusicBrainzArtistIDs)
+	setString(vorbisComment, "UTAG_AUDIO_SHA256", track.AudioHash)
+	if track.Chapters == nil {
+		copyChapterComments(vorbisComment, comments)
+	} else {
+		setChapterComments(vorbisComment, track.Chapters, comments, filepath.Base(track.FilePath))
+	}
+
+	names := maps.Keys(track.Custom)
+	slices.Sort(names)
+	for _, name := range names {
+		setStrings(vorbisComment, name, track.Custom[name])
 	}
 
 	vorbisCommentBlock := vorbisComment.Marshal()
 	blocks = append(blocks, &vorbisCommentBlock)
 
+	if len(track.Chapters) > 0 {
+		if streamInfo, err := flacFile.GetStreamInfo(); err == nil && streamInfo.SampleRate != 0 {
+			cueSheetBlock, err := newCueSheetBlock(track.Chapters, streamInfo.SampleRate, streamInfo.SampleCount)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, cueSheetBlock)
+		}
+	}
+
 	if track.Image != nil {
 		picture, err := flacpicture.NewFromImageData(flacpicture.PictureTypeFrontCover, "", track.Image.Data, track.Image.MimeType)
 		if err == nil {
@@ -188,14 +403,30 @@ func addVorbisCommentsAndPicture(blocks Blocks, track *model.Track) (Blocks, err
 		}
 	}
 
-	padding := flac.MetaDataBlock{Type: flac.Padding, Data: make([]byte, 64)}
-	blocks = append(blocks, &padding)
-
 	return blocks, nil
 }
 
+// メタデータブロックのデータの最大のバイト数
+const maxBlockSize = 1<<24 - 1
+
+func newPaddingBlock(size int) *flac.MetaDataBlock {
+	return &flac.MetaDataBlock{Type: flac.Padding, Data: make([]byte, size)}
+}
+
 func setInt(vorbisComment *flacvorbis.MetaDataBlockVorbisComment, name string, value int) {
 	if value != 0 {
 		vorbisComment.Add(name, strconv.Itoa(value))
 	}
 }
+
+func setString(vorbisComment *flacvorbis.MetaDataBlockVorbisComment, name string, value string) {
+	if value != "" {
+		vorbisComment.Add(name, value)
+	}
+}
+
+func setStrings(vorbisComment *flacvorbis.MetaDataBlockVorbisComment, name string, values []string) {
+	for _, value := range values {
+		setString(vorbisComment, name, value)
+	}
+}
@@ -0,0 +1,53 @@
+package flac
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+func TestGenres(t *testing.T) {
+	filePath := copyTestFile(t)
+	h := &FlacHandler{}
+
+	track := &model.Track{FilePath: filePath, Title: "title", Genres: []string{"Hip-Hop/Rap", "Pop"}}
+	err := h.WriteTrack(track, config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 複数のジャンルはGENREを件数分書く
+	flacFile, err := flac.ParseFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var genres []string
+	for _, block := range flacFile.Meta {
+		if block.Type != flac.VorbisComment {
+			continue
+		}
+		comment, err := flacvorbis.ParseFromMetaDataBlock(*block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		genres, err = comment.Get("GENRE")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(genres, track.Genres) {
+		t.Errorf("GENRE = %q, want %q", genres, track.Genres)
+	}
+
+	read, err := h.ReadTrack(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Genres, track.Genres) {
+		t.Errorf("Genres = %q, want %q", read.Genres, track.Genres)
+	}
+}
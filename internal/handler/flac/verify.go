@@ -0,0 +1,45 @@
+package flac
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+
+	mewflac "github.com/mewkiz/flac"
+)
+
+// すべてのフレームをデコードしてCRCを確認し、STREAMINFOのMD5と照合する。
+// MD5が記録されていなければ(0なら)フレームのCRCと総サンプル数だけを確認する。
+func (h *FlacHandler) VerifyFile(filePath string) error {
+	stream, err := mewflac.Open(filePath)
+	if err != nil {
+		return errors.New("FLACファイルを読み込めませんでした。")
+	}
+	defer stream.Close()
+
+	hash := md5.New()
+	var samples uint64
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%dサンプル目のフレームが壊れています。", samples)
+		}
+
+		frame.Hash(hash)
+		samples += uint64(frame.BlockSize)
+	}
+
+	if stream.Info.NSamples != 0 && samples != stream.Info.NSamples {
+		return fmt.Errorf("サンプル数がSTREAMINFOと一致しません。(%d / %d)", samples, stream.Info.NSamples)
+	}
+
+	if stream.Info.MD5sum != [md5.Size]byte{} && [md5.Size]byte(hash.Sum(nil)) != stream.Info.MD5sum {
+		return errors.New("MD5がSTREAMINFOと一致しません。")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package id3v1
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/solidcopy/utag/internal/model"
+	"github.com/solidcopy/utag/internal/translit"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ID3v1タグのサイズ。ファイルの末尾に置かれる。
+const TagSize = 128
+
+// ID3v1.1のタグを出力する。artistは表示用のアーティスト名。
+// 文字列はLatin-1で書き込み、Latin-1にない文字はASCII文字に変換してから各項目の長さで切り詰める。
+// ジャンルは最初のものを番号に変換する。
+func Marshal(track *model.Track, artist string) []byte {
+	tag := make([]byte, TagSize)
+	copy(tag, "TAG")
+
+	copy(tag[3:33], toLatin1(track.Title, 30))
+	copy(tag[33:63], toLatin1(artist, 30))
+	copy(tag[63:93], toLatin1(track.Album, 30))
+	if date := track.DisplayDate(); len(date) >= 4 {
+		copy(tag[93:97], toLatin1(date[:4], 4))
+	}
+
+	// v1.1ではコメントの最後の2バイトを0とトラック番号にする
+	if track.TrackNumber > 0 && track.TrackNumber <= 255 {
+		tag[126] = byte(track.TrackNumber)
+	}
+
+	tag[127] = NoGenre
+	if len(track.Genres) > 0 {
+		tag[127] = GenreIndex(track.Genres[0])
+	}
+
+	return tag
+}
+
+// ID3v1タグを読み込む。ID3v1タグでなければnilを返す。
+func Parse(tag []byte) *model.Track {
+	if len(tag) != TagSize || string(tag[:3]) != "TAG" {
+		return nil
+	}
+
+	track := &model.Track{
+		Title: fromLatin1(tag[3:33]),
+		Album: fromLatin1(tag[63:93]),
+		Date:  fromLatin1(tag[93:97]),
+	}
+
+	if artist := fromLatin1(tag[33:63]); artist != "" {
+		track.Artists = []string{artist}
+	}
+
+	// v1.1ならコメントの最後の2バイトが0とトラック番号になっている
+	if tag[125] == 0 && tag[126] != 0 {
+		track.TrackNumber = int(tag[126])
+	}
+
+	if genre := GenreName(int(tag[127])); genre != "" {
+		track.Genres = []string{genre}
+	}
+
+	return track
+}
+
+// 文字列をLatin-1に変換して最大sizeバイトに切り詰める。
+// Latin-1にない文字が続く部分はASCII文字に変換し、変換できない文字は削除する。
+func toLatin1(s string, size int) []byte {
+	s = norm.NFC.String(s)
+
+	latin1 := []byte{}
+	others := new(strings.Builder)
+	flush := func() {
+		latin1 = append(latin1, translit.ToASCII(others.String())...)
+		others.Reset()
+	}
+	for _, r := range s {
+		if r <= 0xff {
+			flush()
+			latin1 = append(latin1, byte(r))
+		} else {
+			others.WriteRune(r)
+		}
+	}
+	flush()
+
+	if len(latin1) > size {
+		latin1 = latin1[:size]
+	}
+	return latin1
+}
+
+// Latin-1の文字列を読み込む。最初の0以降と末尾の空白は取り除く。
+func fromLatin1(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	s := make([]byte, 0, len(b))
+	for _, c := range b {
+		s = utf8.AppendRune(s, rune(c))
+	}
+	return strings.TrimRight(string(s), " ")
+}
@@ -0,0 +1,123 @@
+package id3v1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		track  model.Track
+		artist string
+		want   model.Track
+	}{
+		{
+			name:   "すべての項目",
+			track:  model.Track{Title: "Title", Album: "Album", Date: "2020-01-02", TrackNumber: 3, Genres: []string{"rock", "Pop"}},
+			artist: "Artist",
+			want:   model.Track{Title: "Title", Artists: []string{"Artist"}, Album: "Album", Date: "2020", TrackNumber: 3, Genres: []string{"Rock"}},
+		},
+		{
+			name:  "録音日があればその年",
+			track: model.Track{Title: "Title", Date: "2020", RecordingDate: "2019-05"},
+			want:  model.Track{Title: "Title", Date: "2019"},
+		},
+		{
+			name:   "Latin-1の文字はそのまま",
+			track:  model.Track{Title: "Café Ñandú"},
+			artist: "Björk",
+			want:   model.Track{Title: "Café Ñandú", Artists: []string{"Björk"}},
+		},
+		{
+			name:   "Latin-1にない文字はASCII文字に変換する",
+			track:  model.Track{Title: "staple stable", Album: "歌物語～Ｓｏｎｇｓ～"},
+			artist: "斎藤千和, 春奈るな",
+			want:   model.Track{Title: "staple stable", Artists: []string{", runa"}, Album: "~Songs~"},
+		},
+		{
+			name:   "30バイトで切り詰める",
+			track:  model.Track{Title: strings.Repeat("a", 31)},
+			artist: strings.Repeat("é", 31),
+			want:   model.Track{Title: strings.Repeat("a", 30), Artists: []string{strings.Repeat("é", 30)}},
+		},
+		{
+			name:  "255より大きいトラック番号は書き込まない",
+			track: model.Track{Title: "Title", TrackNumber: 256},
+			want:  model.Track{Title: "Title"},
+		},
+		{
+			name:  "番号のないジャンルは書き込まない",
+			track: model.Track{Title: "Title", Genres: []string{"J-Pop"}},
+			want:  model.Track{Title: "Title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := Marshal(&tt.track, tt.artist)
+			if len(tag) != TagSize {
+				t.Fatalf("len(tag) = %d", len(tag))
+			}
+
+			got := Parse(tag)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	// v1.0のタグはコメントが30バイトある
+	v10 := make([]byte, TagSize)
+	copy(v10, "TAG")
+	copy(v10[3:], "Title   ")
+	copy(v10[97:], strings.Repeat("c", 30))
+	v10[127] = NoGenre
+
+	if got := Parse(v10); got == nil || got.Title != "Title" || got.TrackNumber != 0 || got.Genres != nil {
+		t.Errorf("v1.0: %+v", got)
+	}
+
+	if got := Parse(append([]byte("TAX"), v10[3:]...)); got != nil {
+		t.Errorf("TAGで始まらない: %+v", got)
+	}
+	if got := Parse(v10[:TagSize-1]); got != nil {
+		t.Errorf("長さが足りない: %+v", got)
+	}
+}
+
+func TestGenre(t *testing.T) {
+	tests := []struct {
+		name  string
+		index byte
+	}{
+		{"Blues", 0},
+		{"Rock", 17},
+		{"rock", 17},
+		{"Psybient", 191},
+		{"J-Pop", NoGenre},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GenreIndex(tt.name); got != tt.index {
+				t.Errorf("GenreIndex = %d, want %d", got, tt.index)
+			}
+			if tt.index != NoGenre && !strings.EqualFold(GenreName(int(tt.index)), tt.name) {
+				t.Errorf("GenreName = %q", GenreName(int(tt.index)))
+			}
+		})
+	}
+
+	if got := GenreName(-1); got != "" {
+		t.Errorf("GenreName(-1) = %q", got)
+	}
+	if got := GenreName(NoGenre); got != "" {
+		t.Errorf("GenreName(NoGenre) = %q", got)
+	}
+}
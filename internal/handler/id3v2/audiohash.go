@@ -0,0 +1,79 @@
+package id3v2
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 音声データのSHA-256を返す。
+// MP3は最初のフレームから末尾のID3v1タグとAPEタグの手前まで、DSFはdataチャンクの中身を対象とする。
+func (h *Id3v2Handler) HashAudio(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return hashAudio(io.NewSectionReader(file, 0, stat.Size()), filepath.Ext(filePath) == ".dsf")
+}
+
+func hashAudio(file *io.SectionReader, isDsf bool) (string, error) {
+	var start, end int64
+	var err error
+	if isDsf {
+		start, end, err = findDsfData(file)
+	} else {
+		start, end, err = findMpegAudio(file, file.Size())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, io.NewSectionReader(file, start, end-start))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dataチャンクの中身の開始位置と終了位置を返す。
+// dataチャンクはDSDチャンク(28バイト)とfmtチャンク(52バイト)の後にある。
+func findDsfData(r io.ReaderAt) (int64, int64, error) {
+	header := make([]byte, 12)
+	_, err := r.ReadAt(header, 28+52)
+	if err != nil || string(header[:4]) != "data" {
+		return 0, 0, errors.New("dataチャンクがありません。")
+	}
+
+	start := int64(28 + 52 + 12)
+	size := int64(binary.LittleEndian.Uint64(header[4:12])) - 12
+
+	return start, start + size, nil
+}
+
+func findMpegAudio(r io.ReaderAt, fileSize int64) (int64, int64, error) {
+	start, err := skipId3v2Tag(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := findApeTagStart(r, findMpegAudioEnd(r, fileSize))
+
+	start, _, err = findFirstMpegFrame(r, start, end)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return start, end, nil
+}
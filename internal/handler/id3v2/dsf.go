@@ -0,0 +1,59 @@
+package id3v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// DSFのfmtチャンクの内容
+type dsfFormat struct {
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+	sampleCount   int64
+	// チャンネルごとのブロックのバイト数
+	blockSize int
+}
+
+// fmtチャンクはDSDチャンク(28バイト)の直後にある。
+func readDsfFormat(r io.ReaderAt) (*dsfFormat, error) {
+	buff := make([]byte, 52)
+	_, err := r.ReadAt(buff, 28)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(buff[:4]) != "fmt " {
+		return nil, errors.New("DSFファイルの形式が不正です。")
+	}
+
+	format := &dsfFormat{
+		channels:      int(binary.LittleEndian.Uint32(buff[24:28])),
+		sampleRate:    int(binary.LittleEndian.Uint32(buff[28:32])),
+		bitsPerSample: int(binary.LittleEndian.Uint32(buff[32:36])),
+		sampleCount:   int64(binary.LittleEndian.Uint64(buff[36:44])),
+		blockSize:     int(binary.LittleEndian.Uint32(buff[44:48])),
+	}
+
+	return format, nil
+}
+
+func getDsfStreamInfo(r io.ReaderAt) model.StreamInfo {
+	format, err := readDsfFormat(r)
+	if err != nil || format.sampleRate == 0 {
+		return model.StreamInfo{}
+	}
+
+	return model.StreamInfo{
+		Duration:   time.Duration(float64(format.sampleCount) / float64(format.sampleRate) * float64(time.Second)),
+		Codec:      "DSD",
+		SampleRate: format.sampleRate,
+		BitDepth:   format.bitsPerSample,
+		Channels:   format.channels,
+		Bitrate:    format.sampleRate * format.bitsPerSample * format.channels,
+	}
+}
@@ -1,6 +1,7 @@
 package id3v2
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -8,11 +9,17 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/bogem/id3v2/v2"
+	"github.com/solidcopy/utag/internal/atomicfile"
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/handler/id3v1"
 	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type Id3v2Handler struct {
@@ -26,18 +33,33 @@ func (h *Id3v2Handler) ReadTrack(filePath string) (*model.Track, error) {
 	}
 	defer file.Close()
 
+	var streamInfo model.StreamInfo
+
 	if filepath.Ext(filePath) == ".dsf" {
+		streamInfo = getDsfStreamInfo(file)
+
 		pointer, err := seekToMetadataChunk(file)
 		if err != nil {
 			return nil, err
 		}
 
 		if pointer == 0 {
-			return &model.Track{FilePath: filePath}, nil
+			return &model.Track{FilePath: filePath, Stream: streamInfo}, nil
+		}
+	} else {
+		streamInfo = getMpegStreamInfo(file)
+
+		// ID3v2タグがなければID3v1タグを読み込む
+		if start, err := skipId3v2Tag(file); err == nil && start == 0 {
+			if track := readId3v1Tag(file); track != nil {
+				track.FilePath = filePath
+				track.Stream = streamInfo
+				return track, nil
+			}
 		}
 	}
 
-	tags, err := id3v2.ParseReader(file, id3v2.Options{Parse: true})
+	tags, err := parseTag(file)
 	if err != nil {
 		return nil, err
 	}
@@ -45,33 +67,154 @@ func (h *Id3v2Handler) ReadTrack(filePath string) (*model.Track, error) {
 	discNumber, totalDiscs := parsePosAndTotal(tags.GetTextFrame("TPOS").Text)
 	trackNumber, totalTracks := parsePosAndTotal(tags.GetTextFrame("TRCK").Text)
 
-	var artists []string
-	switch tags.Version() {
-	case byte(3):
-		artists = strings.Split(tags.Artist(), "/")
-	case byte(4):
-		artists = strings.Split(tags.Artist(), "\x00")
-	default:
-		artists = []string{tags.Artist()}
-	}
-
 	track := &model.Track{
-		FilePath:    filePath,
-		Album:       tags.Album(),
-		AlbumArtist: tags.GetTextFrame("TPE2").Text,
-		Date:        tags.GetTextFrame("TDRL").Text,
-		Image:       getImage(tags),
-		DiscNumber:  discNumber,
-		TotalDiscs:  totalDiscs,
-		TrackNumber: trackNumber,
-		TotalTracks: totalTracks,
-		Title:       tags.Title(),
-		Artists:     artists,
+		FilePath:        filePath,
+		Album:           tags.Album(),
+		AlbumArtist:     tags.GetTextFrame("TPE2").Text,
+		Compilation:     tags.GetTextFrame("TCMP").Text == "1",
+		Image:           getImage(tags),
+		AlbumSort:       tags.GetTextFrame("TSOA").Text,
+		AlbumArtistSort: tags.GetTextFrame("TSO2").Text,
+		DiscNumber:      discNumber,
+		TotalDiscs:      totalDiscs,
+		TrackNumber:     trackNumber,
+		TotalTracks:     totalTracks,
+		Title:           tags.Title(),
+		Artists:         getArtists(tags),
+		Genres:          getGenres(tags),
+		TitleSort:       tags.GetTextFrame("TSOT").Text,
+		ArtistSort:      tags.GetTextFrame("TSOP").Text,
+
+		MusicBrainzAlbumID:        getUserDefinedText(tags, "MusicBrainz Album Id"),
+		MusicBrainzReleaseGroupID: getUserDefinedText(tags, "MusicBrainz Release Group Id"),
+		MusicBrainzAlbumArtistIDs: splitIDs(getUserDefinedText(tags, "MusicBrainz Album Artist Id")),
+		MusicBrainzTrackID:        getUFID(tags, musicBrainzOwner),
+		MusicBrainzReleaseTrackID: getUserDefinedText(tags, "MusicBrainz Release Track Id"),
+		MusicBrainzArtistIDs:      splitIDs(getUserDefinedText(tags, "MusicBrainz Artist Id")),
+
+		AudioHash: getUserDefinedText(tags, "UTAG_AUDIO_SHA256"),
+		Custom:    getCustomTexts(tags),
+
+		Stream: streamInfo,
 	}
 
+	getDates(tags, track)
+
 	return track, nil
 }
 
+// 複数の値が書かれたテキストフレームの値を\x00で分割する。
+// v2.3の/区切りはHip-Hop/Rapのような値と区別できないので分割しない。
+func splitValues(tags *id3v2.Tag, text string) []string {
+	if tags.Version() < 3 {
+		return []string{text}
+	}
+	return strings.Split(strings.TrimRight(text, "\x00"), "\x00")
+}
+
+// アーティストをTXXX:ARTISTSから読み込む。なければTPE1を表示用のアーティスト名として読み込む。
+// TPE1はv2.4で\x00区切りになっていれば分割するが、v2.3ではAC/DCのような名前があるので/では分割しない。
+func getArtists(tags *id3v2.Tag) []string {
+	if artists := getUserDefinedText(tags, "ARTISTS"); artists != "" {
+		return strings.Split(strings.TrimRight(artists, "\x00"), "\x00")
+	}
+
+	artist := tags.Artist()
+	if artist == "" {
+		return nil
+	}
+	if tags.Version() == 4 {
+		return strings.Split(artist, "\x00")
+	}
+	return []string{artist}
+}
+
+// v2.3で使われる「(番号)」の形式のジャンル
+var genreRefPattern = regexp.MustCompile(`^\((\d+)\)(.*)$`)
+
+// TCONからジャンルを読み込む。
+// 「(17)」や「17」のようなID3v1のジャンル番号は名前に変換する。
+// 「(17)Rock」のように番号の後に名前があれば名前を使う。
+func getGenres(tags *id3v2.Tag) []string {
+	text := tags.GetTextFrame("TCON").Text
+	if text == "" {
+		return nil
+	}
+
+	genres := splitValues(tags, text)
+	for i, genre := range genres {
+		number := genre
+		if match := genreRefPattern.FindStringSubmatch(genre); match != nil {
+			if match[2] != "" {
+				genres[i] = match[2]
+				continue
+			}
+			number = match[1]
+		}
+
+		if index, err := strconv.Atoi(number); err == nil {
+			if name := id3v1.GenreName(index); name != "" {
+				genres[i] = name
+			}
+		}
+	}
+	return genres
+}
+
+// MusicBrainzのレコーディングの識別子を設定するUFIDの所有者
+const musicBrainzOwner = "http://musicbrainz.org"
+
+func getUserDefinedText(tags *id3v2.Tag, description string) string {
+	for _, frame := range tags.GetFrames("TXXX") {
+		udtf, ok := frame.(id3v2.UserDefinedTextFrame)
+		if ok && udtf.Description == description {
+			return udtf.Value
+		}
+	}
+	return ""
+}
+
+// 決まった項目として読み書きするTXXXの説明
+var knownUserDefinedTexts = []string{
+	"MusicBrainz Album Id", "MusicBrainz Release Group Id", "MusicBrainz Album Artist Id",
+	"MusicBrainz Release Track Id", "MusicBrainz Artist Id", "UTAG_AUDIO_SHA256",
+	"RELEASEDATE", "ARTISTS",
+}
+
+// 決まった項目以外のTXXXを返す。複数の値は\x00区切りで書かれている。
+func getCustomTexts(tags *id3v2.Tag) map[string][]string {
+	var custom map[string][]string
+	for _, frame := range tags.GetFrames("TXXX") {
+		udtf, ok := frame.(id3v2.UserDefinedTextFrame)
+		if !ok || slices.Contains(knownUserDefinedTexts, udtf.Description) {
+			continue
+		}
+		if custom == nil {
+			custom = map[string][]string{}
+		}
+		custom[udtf.Description] = strings.Split(strings.TrimRight(udtf.Value, "\x00"), "\x00")
+	}
+	return custom
+}
+
+func getUFID(tags *id3v2.Tag, owner string) string {
+	for _, frame := range tags.GetFrames("UFID") {
+		ufid, ok := frame.(id3v2.UFIDFrame)
+		if ok && ufid.OwnerIdentifier == owner {
+			return string(ufid.Identifier)
+		}
+	}
+	return ""
+}
+
+// 複数の識別子は\x00区切りで書かれている。
+// 以前のバージョンや他のソフトがv2.3で/区切りで書いたものも読めるように、識別子に含まれない/でも分割する。
+func splitIDs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\x00' || r == '/'
+	})
+}
+
 func getImage(tags *id3v2.Tag) *model.Image {
 	frames := tags.GetFrames("APIC")
 	if len(frames) == 0 {
@@ -105,125 +248,255 @@ func getImage(tags *id3v2.Tag) *model.Image {
 	return &model.Image{MimeType: mimeType, Data: data}
 }
 
-func (h *Id3v2Handler) WriteTrack(track *model.Track) error {
+func (h *Id3v2Handler) WriteTrack(track *model.Track, conf *config.Config) error {
 
-	if filepath.Ext(track.FilePath) == ".dsf" {
-		tags := id3v2.NewEmptyTag()
-		SetTags(tags, track)
+	tags := id3v2.NewEmptyTag()
+	SetTags(tags, track, conf)
 
-		var pointer int64
-		{
-			file, err := os.Open(track.FilePath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	file, err := os.Open(track.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-			pointer, err = seekToMetadataChunk(file)
-			if err != nil {
-				return err
-			}
-		}
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := stat.Size()
 
-		// 既存のタグを削除する
-		if pointer != 0 {
-			err := os.Truncate(track.FilePath, pointer)
-			if err != nil {
-				return err
-			}
-		}
+	isDsf := filepath.Ext(track.FilePath) == ".dsf"
+
+	// 書き込んだ後の音声データのハッシュを、置き換えや上書きの前に元のハッシュと比較する
+	hash := func(r *io.SectionReader) (string, error) {
+		return hashAudio(r, isDsf)
+	}
+	audioHash, err := hash(io.NewSectionReader(file, 0, fileSize))
+	if err != nil {
+		return err
+	}
 
-		file, err := os.OpenFile(track.FilePath, os.O_WRONLY, 0666)
+	// MP3の末尾に書き込むID3v1タグ
+	var v1Tag []byte
+	if conf.ID3v1 && !isDsf {
+		v1Tag = id3v1.Marshal(track, track.DisplayArtist(conf.ArtistSeparator, conf.MergeAlbumArtist))
+	}
+	hasV1Tag := !isDsf && findMpegAudioEnd(file, fileSize) != fileSize
+
+	// 既存のタグの領域に収まれば、その部分だけを書き換える
+	var tagStart, tagEnd int64
+	if isDsf {
+		tagStart, tagEnd, err = findDsfTag(file, fileSize)
+	} else {
+		tagStart, tagEnd, err = findMpegTag(file, fileSize)
+	}
+	if err != nil {
+		return err
+	}
+	// ID3v1タグを書き込まないのに残っている場合は、削除するために書き直す
+	if tagEnd > tagStart && int64(tags.Size()) <= tagEnd-tagStart && (v1Tag != nil || !hasV1Tag) {
+		tag, err := marshalTag(tags, int(tagEnd-tagStart)-tags.Size())
 		if err != nil {
 			return err
 		}
-		defer file.Close()
 
-		endPointer, err := file.Seek(0, io.SeekEnd)
-		if err != nil {
-			return err
+		// 既存のID3v1タグは上書きし、なければ末尾に追加する
+		v1Start := fileSize
+		if hasV1Tag {
+			v1Start -= id3v1.TagSize
 		}
 
-		writtenSize, err := tags.WriteTo(file)
+		patched := atomicfile.Patch(file, fileSize, tag, tagStart)
+		if v1Tag != nil {
+			patched = atomicfile.Patch(patched, patched.Size(), v1Tag, v1Start)
+		}
+		err = atomicfile.CheckHash(patched, hash, audioHash)
 		if err != nil {
 			return err
 		}
 
-		buff := make([]byte, 8)
+		file.Close()
 
-		// ファイル容量を更新する
-		file.Seek(12, io.SeekStart)
-		binary.LittleEndian.PutUint64(buff, uint64(endPointer)+uint64(writtenSize))
-		file.Write(buff)
+		err = atomicfile.WriteAt(track.FilePath, tag, tagStart)
+		if err != nil || v1Tag == nil {
+			return err
+		}
+		return atomicfile.WriteAt(track.FilePath, v1Tag, v1Start)
+	}
 
-		// メタデータチャンクの開始位置を更新する
-		binary.LittleEndian.PutUint64(buff, uint64(endPointer))
-		file.Write(buff)
+	tag, err := marshalTag(tags, conf.ImportPadding)
+	if err != nil {
+		return err
+	}
+
+	// 元のファイルは変更せず、一時ファイルに書き込んでから置き換える
+	newFile, err := atomicfile.Create(track.FilePath)
+	if err != nil {
+		return err
+	}
+	defer newFile.Abort()
 
+	if isDsf {
+		err = writeDsf(newFile.File, file, fileSize, tag)
 	} else {
-		tags, err := id3v2.Open(track.FilePath, id3v2.Options{Parse: false})
-		if err != nil {
-			return err
-		}
+		err = writeMpeg(newFile.File, file, fileSize, tag, v1Tag)
+	}
+	if err != nil {
+		return err
+	}
 
-		SetTags(tags, track)
+	file.Close()
 
-		err = tags.Save()
-		if err != nil {
-			return err
-		}
+	content, err := newFile.Content()
+	if err != nil {
+		return err
+	}
+	err = atomicfile.CheckHash(content, hash, audioHash)
+	if err != nil {
+		return err
+	}
 
-		file, err := os.Open(track.FilePath)
-		if err != nil {
-			return err
-		}
+	return newFile.Commit()
+}
 
-		stat, err := os.Stat(track.FilePath)
-		if err != nil {
-			return err
-		}
+// タグを余白を付けて出力する。
+func marshalTag(tags *id3v2.Tag, padding int) ([]byte, error) {
+	buff := new(bytes.Buffer)
+	_, err := tags.WriteTo(buff)
+	if err != nil {
+		return nil, err
+	}
 
-		fileSize := stat.Size()
+	// フレームがなければヘッダーも出力されない
+	if buff.Len() == 0 {
+		buff.Write([]byte{'I', 'D', '3', tags.Version(), 0, 0, 0, 0, 0, 0})
+	}
 
-		if fileSize > 128 {
-			pointer := fileSize - 128
-			_, err = file.Seek(pointer, io.SeekStart)
-			if err != nil {
-				return err
-			}
+	tag := append(buff.Bytes(), make([]byte, padding)...)
 
-			var buff [3]byte
-			_, err = file.Read(buff[:])
-			if err != nil {
-				return err
-			}
+	// ヘッダーのサイズに余白を含める
+	size := len(tag) - 10
+	if size >= 1<<28 {
+		return nil, errors.New("タグが大きすぎます。")
+	}
+	putSynchsafeSize(tag[6:], size)
 
-			err = file.Close()
-			if err != nil {
-				return err
-			}
+	return tag, nil
+}
 
-			if string(buff[:]) == "TAG" {
-				err = os.Truncate(track.FilePath, pointer)
-				if err != nil {
-					return err
-				}
-			}
-		}
+// DSFの既存のタグの領域を返す。タグがなければ両方とも0を返す。
+func findDsfTag(file *os.File, fileSize int64) (int64, int64, error) {
+	pointer, err := seekToMetadataChunk(file)
+	if err != nil || pointer == 0 {
+		return 0, 0, err
+	}
+
+	return pointer, fileSize, nil
+}
+
+// MP3の既存のタグの領域を返す。
+// フッター付きのタグは書き直すので両方とも0を返す。
+func findMpegTag(file *os.File, fileSize int64) (int64, int64, error) {
+	header := make([]byte, 10)
+	_, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+	if string(header[:3]) != "ID3" || header[5]&0x10 != 0 {
+		return 0, 0, nil
+	}
+
+	end, err := skipId3v2Tag(file)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	return nil
+	return 0, end, nil
 }
 
-func SetTags(tags *id3v2.Tag, track *model.Track) {
-	tags.SetVersion(4)
+// DSFは既存のメタデータチャンクより前をコピーし、その後にタグを書き込む。
+func writeDsf(newFile *os.File, file *os.File, fileSize int64, tag []byte) error {
+	pointer, err := seekToMetadataChunk(file)
+	if err != nil {
+		return err
+	}
+
+	// 既存のタグは書き込まない
+	endPointer := fileSize
+	if pointer != 0 {
+		endPointer = pointer
+	}
+
+	_, err = io.Copy(newFile, io.NewSectionReader(file, 0, endPointer))
+	if err != nil {
+		return err
+	}
+
+	_, err = newFile.Write(tag)
+	if err != nil {
+		return err
+	}
+
+	buff := make([]byte, 16)
+
+	// ファイル容量を更新する
+	binary.LittleEndian.PutUint64(buff, uint64(endPointer)+uint64(len(tag)))
+
+	// メタデータチャンクの開始位置を更新する
+	binary.LittleEndian.PutUint64(buff[8:], uint64(endPointer))
+
+	_, err = newFile.WriteAt(buff, 12)
+	return err
+}
+
+// MP3は先頭にタグを書き込み、既存のID3v2タグと末尾のID3v1タグを除いた部分をコピーする。
+// v1Tagがnilでなければ末尾にID3v1タグとして書き込む。
+func writeMpeg(newFile *os.File, file *os.File, fileSize int64, tag []byte, v1Tag []byte) error {
+	start, err := skipId3v2Tag(file)
+	if err != nil {
+		return err
+	}
+	end := findMpegAudioEnd(file, fileSize)
+	if end < start {
+		return errors.New("MP3ファイルの形式が不正です。")
+	}
+
+	_, err = newFile.Write(tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(newFile, io.NewSectionReader(file, start, end-start))
+	if err != nil {
+		return err
+	}
+
+	_, err = newFile.Write(v1Tag)
+	return err
+}
+
+// 設定のID3v2のバージョンが4ならv2.4、3ならv2.3のタグを設定する。
+// v2.3では文字列をUTF-16で書き込み、v2.4にしかないフレームは使わない。
+func SetTags(tags *id3v2.Tag, track *model.Track, conf *config.Config) {
+	version := byte(conf.ID3v2Version)
+	tags.SetVersion(version)
+	encoding := tags.DefaultEncoding()
+	if version == 3 {
+		encoding = id3v2.EncodingUTF16
+		tags.SetDefaultEncoding(encoding)
+	}
+
 	tags.SetAlbum(track.Album)
-	tags.AddTextFrame("TPE2", id3v2.EncodingUTF8, track.AlbumArtist)
-	tags.AddTextFrame("TDRL", id3v2.EncodingUTF8, track.Date)
+	tags.AddTextFrame("TPE2", encoding, track.AlbumArtist)
+	// TCMPはiTunesのフレームだが、多くのプレーヤーがコンピレーションの判定に使う
+	if track.Compilation {
+		addTextFrame(tags, "TCMP", "1")
+	}
+	setDates(tags, track, version)
 
 	if track.Image != nil {
 		tags.AddAttachedPicture(id3v2.PictureFrame{
-			Encoding:    id3v2.EncodingUTF8,
+			Encoding:    encoding,
 			MimeType:    track.Image.MimeType,
 			PictureType: id3v2.PTFrontCover,
 			Description: "Cover",
@@ -231,17 +504,127 @@ func SetTags(tags *id3v2.Tag, track *model.Track) {
 		})
 	}
 
-	tags.AddTextFrame("TPOS", id3v2.EncodingUTF8, formatPosAndTotal(track.DiscNumber, track.TotalDiscs))
-	tags.AddTextFrame("TRCK", id3v2.EncodingUTF8, formatPosAndTotal(track.TrackNumber, track.TotalTracks))
+	tags.AddTextFrame("TPOS", encoding, formatPosAndTotal(track.DiscNumber, track.TotalDiscs))
+	tags.AddTextFrame("TRCK", encoding, formatPosAndTotal(track.TrackNumber, track.TotalTracks))
 	tags.SetTitle(track.Title)
 
-	artists := []string{}
-	if track.AlbumArtist != "" {
-		artists = append(artists, track.AlbumArtist)
+	// TPE1には表示用のアーティスト名を設定し、複数のアーティストはTXXX:ARTISTSにも設定する。
+	// ARTISTSは名前に/が含まれることがあるので、v2.3でも\x00で区切る
+	addTextFrame(tags, "TPE1", track.DisplayArtist(conf.ArtistSeparator, conf.MergeAlbumArtist))
+	if artists := track.TagArtists(conf.MergeAlbumArtist); len(artists) > 1 {
+		addUserDefinedText(tags, "ARTISTS", strings.Join(artists, "\x00"))
+	}
+	// 複数のジャンルはv2.3でも\x00で区切る。/で区切るとHip-Hop/Rapのようなジャンルと区別できない
+	addTextFrame(tags, "TCON", strings.Join(track.Genres, "\x00"))
+
+	// TSOA、TSOT、TSOPはv2.4のフレームだが、v2.3でも広く使われているので書き込む
+	addTextFrame(tags, "TSOA", track.AlbumSort)
+	addTextFrame(tags, "TSO2", track.AlbumArtistSort)
+	addTextFrame(tags, "TSOT", track.TitleSort)
+	addTextFrame(tags, "TSOP", track.ArtistSort)
+
+	addUserDefinedText(tags, "MusicBrainz Album Id", track.MusicBrainzAlbumID)
+	addUserDefinedText(tags, "MusicBrainz Release Group Id", track.MusicBrainzReleaseGroupID)
+	addUserDefinedText(tags, "MusicBrainz Album Artist Id", strings.Join(track.MusicBrainzAlbumArtistIDs, "\x00"))
+	if track.MusicBrainzTrackID != "" {
+		tags.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: musicBrainzOwner, Identifier: []byte(track.MusicBrainzTrackID)})
+	}
+	addUserDefinedText(tags, "MusicBrainz Release Track Id", track.MusicBrainzReleaseTrackID)
+	addUserDefinedText(tags, "MusicBrainz Artist Id", strings.Join(track.MusicBrainzArtistIDs, "\x00"))
+	addUserDefinedText(tags, "UTAG_AUDIO_SHA256", track.AudioHash)
+
+	names := maps.Keys(track.Custom)
+	slices.Sort(names)
+	for _, name := range names {
+		addUserDefinedText(tags, name, strings.Join(track.Custom[name], "\x00"))
+	}
+}
+
+// yyyy、yyyy-mm、yyyy-mm-ddの形式の日付
+var datePattern = regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?$`)
+
+// 日付のフレームを設定する。
+// v2.4では録音日(なければ発売日)をTDRC、発売日をTDRL、オリジナルの発売日をTDORに設定する。
+// v2.3では録音日(なければ発売日)をTYERとTDAT、録音日と異なる発売日をTXXX:RELEASEDATE、
+// オリジナルの発売年をTORYに設定する。
+func setDates(tags *id3v2.Tag, track *model.Track, version byte) {
+	if version != 3 {
+		addTextFrame(tags, "TDRC", track.DisplayDate())
+		addTextFrame(tags, "TDRL", track.Date)
+		addTextFrame(tags, "TDOR", track.OriginalDate)
+		return
+	}
+
+	setYearAndDate(tags, track.DisplayDate())
+	if track.RecordingDate != "" {
+		addUserDefinedText(tags, "RELEASEDATE", track.Date)
+	}
+	if len(track.OriginalDate) >= 4 {
+		addTextFrame(tags, "TORY", track.OriginalDate[:4])
+	}
+}
+
+// v2.3のTYER(年)とTDAT(日月)を設定する。
+// 日付の形式でなければそのままTYERに設定する。
+func setYearAndDate(tags *id3v2.Tag, date string) {
+	match := datePattern.FindStringSubmatch(date)
+	if match == nil {
+		addTextFrame(tags, "TYER", date)
+		return
+	}
+
+	addTextFrame(tags, "TYER", match[1])
+	if match[3] != "" {
+		addTextFrame(tags, "TDAT", match[3]+match[2])
+	}
+}
+
+// 日付のフレームからトラックの発売日、録音日、オリジナルの発売日を設定する。
+// v2.4のフレームがなければv2.3のフレームから読み込む。
+func getDates(tags *id3v2.Tag, track *model.Track) {
+	recordingDate := tags.GetTextFrame("TDRC").Text
+	if recordingDate == "" {
+		recordingDate = getYearAndDate(tags)
+	}
+
+	releaseDate := tags.GetTextFrame("TDRL").Text
+	if releaseDate == "" {
+		releaseDate = getUserDefinedText(tags, "RELEASEDATE")
+	}
+
+	track.SetDates(recordingDate, releaseDate)
+
+	track.OriginalDate = tags.GetTextFrame("TDOR").Text
+	if track.OriginalDate == "" {
+		track.OriginalDate = tags.GetTextFrame("TORY").Text
+	}
+}
+
+// v2.3のTYER(年)とTDAT(日月)から日付を読み込む。
+func getYearAndDate(tags *id3v2.Tag) string {
+	date := tags.GetTextFrame("TYER").Text
+	if dayMonth := tags.GetTextFrame("TDAT").Text; len(date) == 4 && len(dayMonth) == 4 {
+		date += "-" + dayMonth[2:] + "-" + dayMonth[:2]
+	}
+	return date
+}
+
+// 値が空でなければテキストフレームを追加する。
+func addTextFrame(tags *id3v2.Tag, id string, value string) {
+	if value != "" {
+		tags.AddTextFrame(id, tags.DefaultEncoding(), value)
+	}
+}
+
+// 値が空でなければTXXXフレームを追加する。
+func addUserDefinedText(tags *id3v2.Tag, description string, value string) {
+	if value != "" {
+		tags.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    tags.DefaultEncoding(),
+			Description: description,
+			Value:       value,
+		})
 	}
-	artists = append(artists, track.Artists...)
-	// v2.4で保存するので、\x00区切りにする
-	tags.SetArtist(strings.Join(artists, "\x00"))
 }
 
 // DSFはID3v2がファイルの先頭ではなく末尾にある。
@@ -0,0 +1,56 @@
+package id3v2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+func TestSetTagsMultipleValues(t *testing.T) {
+	track := &model.Track{
+		Title:                     "title",
+		Artists:                   []string{"AC/DC", "Someone"},
+		Genres:                    []string{"Hip-Hop/Rap", "Pop"},
+		MusicBrainzAlbumArtistIDs: []string{"a1", "a2"},
+		MusicBrainzArtistIDs:      []string{"b1", "b2"},
+		Custom:                    map[string][]string{"MOOD": {"happy/sad", "calm"}},
+	}
+
+	for _, version := range []int{3, 4} {
+		t.Run(map[int]string{3: "v2.3", 4: "v2.4"}[version], func(t *testing.T) {
+			conf := config.Default()
+			conf.ID3v2Version = version
+
+			tags := id3v2.NewEmptyTag()
+			SetTags(tags, track, conf)
+			data, err := marshalTag(tags, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := parseTag(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := getArtists(parsed); !reflect.DeepEqual(got, track.Artists) {
+				t.Errorf("Artists = %q", got)
+			}
+			if got := getGenres(parsed); !reflect.DeepEqual(got, track.Genres) {
+				t.Errorf("Genres = %q", got)
+			}
+			if got := splitIDs(getUserDefinedText(parsed, "MusicBrainz Album Artist Id")); !reflect.DeepEqual(got, track.MusicBrainzAlbumArtistIDs) {
+				t.Errorf("MusicBrainzAlbumArtistIDs = %q", got)
+			}
+			if got := splitIDs(getUserDefinedText(parsed, "MusicBrainz Artist Id")); !reflect.DeepEqual(got, track.MusicBrainzArtistIDs) {
+				t.Errorf("MusicBrainzArtistIDs = %q", got)
+			}
+			if got := getCustomTexts(parsed); !reflect.DeepEqual(got, track.Custom) {
+				t.Errorf("Custom = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package id3v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/solidcopy/utag/internal/handler/id3v1"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// MPEGオーディオのフレームヘッダー
+type mpegFrameHeader struct {
+	// 1、2、2.5を10倍した値
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	padding    bool
+	channels   int
+	protected  bool
+}
+
+var mpegBitrates map[int][15]int = map[int][15]int{
+	11: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	12: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	13: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	21: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	22: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	23: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mpegSampleRates map[int][3]int = map[int][3]int{
+	10: {44100, 48000, 32000},
+	20: {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// 4バイトのフレームヘッダーを解析する。
+// フレームヘッダーでなければfalseを返す。
+func parseMpegFrameHeader(b []byte) (*mpegFrameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return nil, false
+	}
+
+	header := &mpegFrameHeader{}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		header.version = 25
+	case 2:
+		header.version = 20
+	case 3:
+		header.version = 10
+	default:
+		return nil, false
+	}
+
+	header.layer = 4 - int((b[1]>>1)&0x03)
+	if header.layer == 4 {
+		return nil, false
+	}
+
+	header.protected = b[1]&0x01 == 0
+
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int((b[2] >> 2) & 0x03)
+	// フリーフォーマットは扱わない
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, false
+	}
+
+	tableVersion := header.version / 10
+	if tableVersion > 2 {
+		tableVersion = 2
+	}
+	header.bitrate = mpegBitrates[tableVersion*10+header.layer][bitrateIndex]
+	header.sampleRate = mpegSampleRates[header.version][sampleRateIndex]
+	header.padding = b[2]&0x02 != 0
+
+	header.channels = 2
+	if b[3]>>6 == 3 {
+		header.channels = 1
+	}
+
+	return header, true
+}
+
+func (h *mpegFrameHeader) samplesPerFrame() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version != 10:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// ヘッダーを含むフレーム全体のバイト数
+func (h *mpegFrameHeader) frameSize() int {
+	padding := 0
+	if h.padding {
+		padding = 1
+	}
+
+	if h.layer == 1 {
+		return (12*h.bitrate*1000/h.sampleRate + padding) * 4
+	}
+	return h.samplesPerFrame()/8*h.bitrate*1000/h.sampleRate + padding
+}
+
+// フレームヘッダーの後のサイド情報のバイト数
+func (h *mpegFrameHeader) sideInfoSize() int {
+	if h.version == 10 {
+		if h.channels == 1 {
+			return 17
+		}
+		return 32
+	}
+	if h.channels == 1 {
+		return 9
+	}
+	return 17
+}
+
+// 先頭のID3v2タグを飛ばした位置を返す。
+func skipId3v2Tag(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	_, err := r.ReadAt(header, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += 10
+	// フッターがある
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return size, nil
+}
+
+// 末尾のID3v1タグを除いた音声データの終了位置を返す。
+func findMpegAudioEnd(r io.ReaderAt, fileSize int64) int64 {
+	if fileSize < 128 {
+		return fileSize
+	}
+
+	buff := make([]byte, 3)
+	_, err := r.ReadAt(buff, fileSize-128)
+	if err == nil && string(buff) == "TAG" {
+		return fileSize - 128
+	}
+
+	return fileSize
+}
+
+// 末尾のID3v1タグを読み込む。なければnilを返す。
+func readId3v1Tag(file *os.File) *model.Track {
+	stat, err := file.Stat()
+	if err != nil || stat.Size() < id3v1.TagSize {
+		return nil
+	}
+
+	tag := make([]byte, id3v1.TagSize)
+	_, err = file.ReadAt(tag, stat.Size()-id3v1.TagSize)
+	if err != nil {
+		return nil
+	}
+
+	return id3v1.Parse(tag)
+}
+
+// 最初のフレームを探す。
+// 誤検出を避けるため、続くフレームのヘッダーも正しいものだけを採用する。
+func findFirstMpegFrame(r io.ReaderAt, start int64, end int64) (int64, *mpegFrameHeader, error) {
+	const searchSize = 64 * 1024
+
+	buff := make([]byte, searchSize)
+	n, err := r.ReadAt(buff, start)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	buff = buff[:n]
+
+	for i := 0; i+4 <= len(buff); i++ {
+		header, ok := parseMpegFrameHeader(buff[i:])
+		if !ok {
+			continue
+		}
+
+		next := make([]byte, 4)
+		nextOffset := start + int64(i) + int64(header.frameSize())
+		if nextOffset+4 <= end {
+			if _, err := r.ReadAt(next, nextOffset); err != nil {
+				continue
+			}
+			if _, ok := parseMpegFrameHeader(next); !ok {
+				continue
+			}
+		}
+
+		return start + int64(i), header, nil
+	}
+
+	return 0, nil, errors.New("MP3のフレームが見つかりません。")
+}
+
+// XingまたはVBRIヘッダーに書かれたフレーム数を返す。
+// なければ0を返す。
+func readVbrFrameCount(r io.ReaderAt, offset int64, header *mpegFrameHeader) int64 {
+	buff := make([]byte, 12)
+
+	_, err := r.ReadAt(buff, offset+4+int64(header.sideInfoSize()))
+	if err == nil && (string(buff[:4]) == "Xing" || string(buff[:4]) == "Info") {
+		flags := binary.BigEndian.Uint32(buff[4:8])
+		if flags&0x01 != 0 {
+			return int64(binary.BigEndian.Uint32(buff[8:12]))
+		}
+	}
+
+	buff = make([]byte, 18)
+	_, err = r.ReadAt(buff, offset+4+32)
+	if err == nil && string(buff[:4]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(buff[14:18]))
+	}
+
+	return 0
+}
+
+func getMpegStreamInfo(file *os.File) model.StreamInfo {
+	stat, err := file.Stat()
+	if err != nil {
+		return model.StreamInfo{}
+	}
+
+	start, err := skipId3v2Tag(file)
+	if err != nil {
+		return model.StreamInfo{}
+	}
+	end := findMpegAudioEnd(file, stat.Size())
+
+	offset, header, err := findFirstMpegFrame(file, start, end)
+	if err != nil {
+		return model.StreamInfo{}
+	}
+
+	streamInfo := model.StreamInfo{
+		Codec:      []string{"", "MP1", "MP2", "MP3"}[header.layer],
+		SampleRate: header.sampleRate,
+		Channels:   header.channels,
+		Bitrate:    header.bitrate * 1000,
+	}
+
+	bits := (end - offset) * 8
+
+	frameCount := readVbrFrameCount(file, offset, header)
+	if frameCount > 0 {
+		samples := frameCount * int64(header.samplesPerFrame())
+		streamInfo.Duration = time.Duration(float64(samples) / float64(header.sampleRate) * float64(time.Second))
+		// 可変ビットレートなら平均を計算する
+		if streamInfo.Duration > 0 {
+			streamInfo.Bitrate = int(float64(bits) / streamInfo.Duration.Seconds())
+		}
+	} else {
+		// 固定ビットレートとみなす
+		streamInfo.Duration = time.Duration(float64(bits) / float64(header.bitrate*1000) * float64(time.Second))
+	}
+
+	return streamInfo
+}
@@ -0,0 +1,311 @@
+package id3v2
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// タグヘッダーのフラグ
+const (
+	tagUnsynchronisation = 0x80
+	// v2.2では圧縮、v2.3以降では拡張ヘッダーを表す
+	tagExtendedHeader = 0x40
+)
+
+// 読み込み位置からID3v2タグを読み込む。タグがなければ空のタグを返す。
+// ライブラリはv2.3とv2.4のフラグのないタグしか正しく読み込めないので、
+// v2.2のタグはv2.3に変換し、非同期化、拡張ヘッダー、フレームの圧縮と暗号化を解除してから読み込む。
+func parseTag(r io.Reader) (*id3v2.Tag, error) {
+	header := make([]byte, 10)
+	_, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && string(header[:3]) != "ID3") {
+		return id3v2.NewEmptyTag(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version := header[3]
+	if version < 2 || version > 4 {
+		return nil, errors.New("対応していないバージョンのID3v2タグです。")
+	}
+
+	data := make([]byte, synchsafeSize(header[6:10]))
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, errors.New("ID3v2タグが途中で切れています。")
+	}
+
+	tag, err := convertTag(version, header[5], data)
+	if err != nil {
+		return nil, err
+	}
+
+	return id3v2.ParseReader(bytes.NewReader(tag), id3v2.Options{Parse: true})
+}
+
+// タグのヘッダーより後の部分を、フラグのないv2.3かv2.4のタグに変換する。
+func convertTag(version byte, flags byte, data []byte) ([]byte, error) {
+	// v2.4より前ではタグ全体が非同期化されている
+	if flags&tagUnsynchronisation != 0 && version < 4 {
+		data = resynchronise(data)
+	}
+
+	if flags&tagExtendedHeader != 0 {
+		if version == 2 {
+			return nil, errors.New("圧縮されたID3v2.2タグには対応していません。")
+		}
+		if len(data) < 4 {
+			return nil, errors.New("ID3v2タグの拡張ヘッダーが不正です。")
+		}
+
+		// 拡張ヘッダーのサイズはv2.3では自身を含まず、v2.4では自身を含む
+		size := int(binary.BigEndian.Uint32(data)) + 4
+		if version == 4 {
+			size = synchsafeSize(data[:4])
+		}
+		if size > len(data) {
+			return nil, errors.New("ID3v2タグの拡張ヘッダーが不正です。")
+		}
+		data = data[size:]
+	}
+
+	newVersion := version
+	if version == 2 {
+		newVersion = 3
+	}
+
+	frames := new(bytes.Buffer)
+	for len(data) > 0 {
+		frame, rest, ok := nextFrame(version, data)
+		if !ok {
+			// 残りは余白か壊れたフレーム
+			break
+		}
+		data = rest
+
+		id, body, err := convertFrame(version, flags, frame)
+		if err != nil {
+			return nil, err
+		}
+		// ライブラリはサイズが0のフレームで読み込みを終えてしまうので書き込まない
+		if id == "" || len(body) == 0 {
+			continue
+		}
+
+		frames.WriteString(id)
+		size := make([]byte, 4)
+		if newVersion == 4 {
+			putSynchsafeSize(size, len(body))
+		} else {
+			binary.BigEndian.PutUint32(size, uint32(len(body)))
+		}
+		frames.Write(size)
+		frames.Write([]byte{0, 0})
+		frames.Write(body)
+	}
+
+	tag := []byte{'I', 'D', '3', newVersion, 0, 0, 0, 0, 0, 0}
+	putSynchsafeSize(tag[6:], frames.Len())
+	return append(tag, frames.Bytes()...), nil
+}
+
+// タグのフレームの生データ
+type rawFrame struct {
+	id    string
+	flags uint16
+	body  []byte
+}
+
+// 先頭のフレームと残りのデータを返す。
+// 余白に達したか、フレームのサイズが残りのデータを超えていればokがfalseになる。
+func nextFrame(version byte, data []byte) (rawFrame, []byte, bool) {
+	// v2.2はIDが3バイト、サイズが3バイトでフラグがない
+	headerSize := 10
+	if version == 2 {
+		headerSize = 6
+	}
+	if len(data) < headerSize || data[0] == 0 {
+		return rawFrame{}, nil, false
+	}
+
+	var frame rawFrame
+	var size int
+	switch version {
+	case 2:
+		frame.id = string(data[:3])
+		size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+	case 3:
+		frame.id = string(data[:4])
+		size = int(binary.BigEndian.Uint32(data[4:8]))
+		frame.flags = binary.BigEndian.Uint16(data[8:10])
+	default:
+		frame.id = string(data[:4])
+		size = synchsafeSize(data[4:8])
+		frame.flags = binary.BigEndian.Uint16(data[8:10])
+	}
+
+	if size > len(data)-headerSize {
+		return rawFrame{}, nil, false
+	}
+	frame.body = data[headerSize : headerSize+size]
+
+	return frame, data[headerSize+size:], true
+}
+
+// フレームの形式のフラグ
+const (
+	v3FrameCompression = 0x0080
+	v3FrameEncryption  = 0x0040
+	v3FrameGrouping    = 0x0020
+
+	v4FrameGrouping            = 0x0040
+	v4FrameCompression         = 0x0008
+	v4FrameEncryption          = 0x0004
+	v4FrameUnsynchronisation   = 0x0002
+	v4FrameDataLengthIndicator = 0x0001
+)
+
+// フレームのフラグを解除して、v2.3かv2.4のフレームのIDと中身を返す。
+// 暗号化されたフレームや、v2.3に対応するフレームのないv2.2のフレームは読み込めないのでIDを空で返す。
+func convertFrame(version byte, tagFlags byte, frame rawFrame) (string, []byte, error) {
+	if version == 2 {
+		id, ok := v22FrameIDs[frame.id]
+		if !ok {
+			return "", nil, nil
+		}
+		if id == "APIC" {
+			return id, convertPicture(frame.body), nil
+		}
+		return id, frame.body, nil
+	}
+
+	body := frame.body
+
+	// フラグに応じてフレームのヘッダーの後に追加の情報がある
+	var compression, encryption bool
+	extraSize := 0
+	if version == 3 {
+		compression = frame.flags&v3FrameCompression != 0
+		encryption = frame.flags&v3FrameEncryption != 0
+		if compression {
+			extraSize += 4
+		}
+		if encryption {
+			extraSize++
+		}
+		if frame.flags&v3FrameGrouping != 0 {
+			extraSize++
+		}
+	} else {
+		compression = frame.flags&v4FrameCompression != 0
+		encryption = frame.flags&v4FrameEncryption != 0
+		if frame.flags&v4FrameGrouping != 0 {
+			extraSize++
+		}
+		if encryption {
+			extraSize++
+		}
+		if frame.flags&v4FrameDataLengthIndicator != 0 {
+			extraSize += 4
+		}
+	}
+
+	if encryption {
+		return "", nil, nil
+	}
+	if extraSize > len(body) {
+		return "", nil, errors.New("ID3v2タグの" + frame.id + "フレームが不正です。")
+	}
+	body = body[extraSize:]
+
+	// v2.4ではフレームごとに非同期化されている
+	if version == 4 && (frame.flags&v4FrameUnsynchronisation != 0 || tagFlags&tagUnsynchronisation != 0) {
+		body = resynchronise(body)
+	}
+
+	if compression {
+		r, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return "", nil, errors.New("ID3v2タグの" + frame.id + "フレームを展開できませんでした。")
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return "", nil, errors.New("ID3v2タグの" + frame.id + "フレームを展開できませんでした。")
+		}
+	}
+
+	return frame.id, body, nil
+}
+
+// v2.2のPICの中身をAPICの形式に変換する。
+// PICは画像の形式を3文字(JPGなど)で、APICはMIMEタイプで表す。
+func convertPicture(body []byte) []byte {
+	if len(body) < 4 {
+		return body
+	}
+
+	mimeType := ""
+	switch string(bytes.ToUpper(body[1:4])) {
+	case "JPG":
+		mimeType = "image/jpeg"
+	case "PNG":
+		mimeType = "image/png"
+	case "GIF":
+		mimeType = "image/gif"
+	case "BMP":
+		mimeType = "image/bmp"
+	}
+
+	picture := []byte{body[0]}
+	picture = append(picture, mimeType...)
+	picture = append(picture, 0)
+	return append(picture, body[4:]...)
+}
+
+// 非同期化で0xFFの後に挿入された0x00を取り除く。
+func resynchronise(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		result = append(result, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return result
+}
+
+func synchsafeSize(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func putSynchsafeSize(b []byte, size int) {
+	b[0] = byte(size >> 21 & 0x7f)
+	b[1] = byte(size >> 14 & 0x7f)
+	b[2] = byte(size >> 7 & 0x7f)
+	b[3] = byte(size & 0x7f)
+}
+
+// v2.2のフレームのIDに対応するv2.3のフレームのID
+var v22FrameIDs = map[string]string{
+	"BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC", "ETC": "ETCO",
+	"EQU": "EQUA", "GEO": "GEOB", "IPL": "IPLS", "LNK": "LINK", "MCI": "MCDI",
+	"MLL": "MLLT", "PIC": "APIC", "POP": "POPM", "REV": "RVRB", "RVA": "RVAD",
+	"SLT": "SYLT", "STC": "SYTC", "TAL": "TALB", "TBP": "TBPM", "TCM": "TCOM",
+	"TCO": "TCON", "TCR": "TCOP", "TDA": "TDAT", "TDY": "TDLY", "TEN": "TENC",
+	"TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN", "TLE": "TLEN",
+	"TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY",
+	"TOT": "TOAL", "TP1": "TPE1", "TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4",
+	"TPA": "TPOS", "TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TRK": "TRCK",
+	"TSI": "TSIZ", "TSS": "TSSE", "TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3",
+	"TXT": "TEXT", "TXX": "TXXX", "TYE": "TYER", "UFI": "UFID", "ULT": "USLT",
+	"WAF": "WOAF", "WAR": "WOAR", "WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP",
+	"WPB": "WPUB", "WXX": "WXXX",
+	// iTunesが使う非公式のフレーム
+	"TCP": "TCMP", "TST": "TSOT", "TSP": "TSOP", "TSA": "TSOA", "TS2": "TSO2", "TSC": "TSOC",
+}
@@ -0,0 +1,288 @@
+package id3v2
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// ヘッダーを付けてタグを作成する。
+func newRawTag(version byte, flags byte, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	tag := []byte{'I', 'D', '3', version, 0, flags, 0, 0, 0, 0}
+	putSynchsafeSize(tag[6:], len(body))
+	return append(tag, body...)
+}
+
+func newFrameV2(id string, body []byte) []byte {
+	frame := append([]byte(id), byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+	return append(frame, body...)
+}
+
+func newFrameV3(id string, flags uint16, body []byte) []byte {
+	frame := binary.BigEndian.AppendUint32([]byte(id), uint32(len(body)))
+	frame = binary.BigEndian.AppendUint16(frame, flags)
+	return append(frame, body...)
+}
+
+func newFrameV4(id string, flags uint16, body []byte) []byte {
+	size := make([]byte, 4)
+	putSynchsafeSize(size, len(body))
+	frame := append([]byte(id), size...)
+	frame = binary.BigEndian.AppendUint16(frame, flags)
+	return append(frame, body...)
+}
+
+// Latin-1のテキストフレームの中身
+func textBody(text string) []byte {
+	return append([]byte{0}, text...)
+}
+
+// 0xFFの後に0x00を挿入する。
+func unsynchronise(data []byte) []byte {
+	result := []byte{}
+	for _, b := range data {
+		result = append(result, b)
+		if b == 0xff {
+			result = append(result, 0)
+		}
+	}
+	return result
+}
+
+func compress(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	buff := new(bytes.Buffer)
+	w := zlib.NewWriter(buff)
+	_, err := w.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+// JPEGの先頭のような0xFFを含む画像
+var testPicture = []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0xff}
+
+// APICフレームの中身
+func apicBody(picture []byte) []byte {
+	body := append([]byte{0}, "image/jpeg"...)
+	body = append(body, 0, 3, 0)
+	return append(body, picture...)
+}
+
+func TestParseTag(t *testing.T) {
+	synchsafe := func(size int) []byte {
+		b := make([]byte, 4)
+		putSynchsafeSize(b, size)
+		return b
+	}
+	sizeAndData := func(size int, data []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(size)), data...)
+	}
+
+	tests := []struct {
+		name      string
+		tag       func(t *testing.T) []byte
+		wantTitle string
+		wantImage *model.Image
+	}{
+		{
+			name: "v2.2",
+			tag: func(t *testing.T) []byte {
+				pic := append([]byte{0}, "JPG"...)
+				pic = append(append(pic, 3, 0), testPicture...)
+				return newRawTag(2, 0,
+					newFrameV2("TT2", textBody("Title")),
+					newFrameV2("XXX", textBody("unknown")),
+					newFrameV2("PIC", pic))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "v2.2の非同期化",
+			tag: func(t *testing.T) []byte {
+				pic := append([]byte{0}, "JPG"...)
+				pic = append(append(pic, 3, 0), testPicture...)
+				frames := append(newFrameV2("TT2", textBody("Title")), newFrameV2("PIC", pic)...)
+				return newRawTag(2, tagUnsynchronisation, unsynchronise(frames))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "v2.3の非同期化",
+			tag: func(t *testing.T) []byte {
+				frames := append(newFrameV3("TIT2", 0, textBody("Title")), newFrameV3("APIC", 0, apicBody(testPicture))...)
+				return newRawTag(3, tagUnsynchronisation, unsynchronise(frames))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "v2.4のフレームごとの非同期化",
+			tag: func(t *testing.T) []byte {
+				body := apicBody(testPicture)
+				return newRawTag(4, 0,
+					newFrameV4("TIT2", 0, textBody("Title")),
+					newFrameV4("APIC", v4FrameUnsynchronisation|v4FrameDataLengthIndicator,
+						append(synchsafe(len(body)), unsynchronise(body)...)))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "v2.4のタグ全体の非同期化",
+			tag: func(t *testing.T) []byte {
+				return newRawTag(4, tagUnsynchronisation,
+					newFrameV4("TIT2", 0, textBody("Title")),
+					newFrameV4("APIC", 0, unsynchronise(apicBody(testPicture))))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "v2.3の拡張ヘッダー",
+			tag: func(t *testing.T) []byte {
+				return newRawTag(3, tagExtendedHeader,
+					sizeAndData(6, make([]byte, 6)),
+					newFrameV3("TIT2", 0, textBody("Title")))
+			},
+			wantTitle: "Title",
+		},
+		{
+			name: "v2.4の拡張ヘッダー",
+			tag: func(t *testing.T) []byte {
+				return newRawTag(4, tagExtendedHeader,
+					append(synchsafe(6), 1, 0),
+					newFrameV4("TIT2", 0, textBody("Title")))
+			},
+			wantTitle: "Title",
+		},
+		{
+			name: "v2.3の圧縮されたフレーム",
+			tag: func(t *testing.T) []byte {
+				body := textBody("Title")
+				return newRawTag(3, 0, newFrameV3("TIT2", v3FrameCompression, sizeAndData(len(body), compress(t, body))))
+			},
+			wantTitle: "Title",
+		},
+		{
+			name: "v2.4の圧縮されたフレーム",
+			tag: func(t *testing.T) []byte {
+				body := apicBody(testPicture)
+				return newRawTag(4, 0,
+					newFrameV4("TIT2", v4FrameGrouping, append([]byte{1}, textBody("Title")...)),
+					newFrameV4("APIC", v4FrameCompression|v4FrameDataLengthIndicator,
+						append(synchsafe(len(body)), compress(t, body)...)))
+			},
+			wantTitle: "Title",
+			wantImage: &model.Image{MimeType: "image/jpeg", Data: testPicture},
+		},
+		{
+			name: "暗号化されたフレームは読み込まない",
+			tag: func(t *testing.T) []byte {
+				return newRawTag(3, 0,
+					newFrameV3("TIT2", v3FrameEncryption, append([]byte{1}, textBody("Secret")...)),
+					newFrameV3("TALB", 0, textBody("Album")))
+			},
+			wantTitle: "",
+		},
+		{
+			name: "余白の後は読み込まない",
+			tag: func(t *testing.T) []byte {
+				return newRawTag(3, 0, newFrameV3("TIT2", 0, textBody("Title")), make([]byte, 20))
+			},
+			wantTitle: "Title",
+		},
+		{
+			name: "ID3v2タグがない",
+			tag: func(t *testing.T) []byte {
+				return []byte("not a tag")
+			},
+			wantTitle: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := parseTag(bytes.NewReader(tt.tag(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tags.Title(); got != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", got, tt.wantTitle)
+			}
+			if got := getImage(tags); !reflect.DeepEqual(got, tt.wantImage) {
+				t.Errorf("Image = %+v, want %+v", got, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestParseTagError(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  []byte
+	}{
+		{"対応していないバージョン", newRawTag(5, 0)},
+		{"圧縮されたv2.2", newRawTag(2, tagExtendedHeader, newFrameV2("TT2", textBody("Title")))},
+		{"拡張ヘッダーのサイズが不正", newRawTag(3, tagExtendedHeader, binary.BigEndian.AppendUint32(nil, 100))},
+		{"途中で切れている", newRawTag(3, 0, newFrameV3("TIT2", 0, textBody("Title")))[:15]},
+		{"展開できない", newRawTag(3, 0, newFrameV3("TIT2", v3FrameCompression, []byte{0, 0, 0, 6, 1, 2, 3}))},
+		{"追加の情報が足りない", newRawTag(4, 0, newFrameV4("TIT2", v4FrameDataLengthIndicator, []byte{0, 0}))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTag(bytes.NewReader(tt.tag))
+			if err == nil {
+				t.Error("エラーにならない")
+			}
+		})
+	}
+}
+
+func TestResynchronise(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want []byte
+	}{
+		{[]byte{0xff, 0x00, 0xe0}, []byte{0xff, 0xe0}},
+		{[]byte{0xff, 0x00, 0x00}, []byte{0xff, 0x00}},
+		{[]byte{0xff, 0x01}, []byte{0xff, 0x01}},
+		{[]byte{0xff}, []byte{0xff}},
+		{[]byte{0x00, 0xff, 0x00}, []byte{0x00, 0xff}},
+	}
+
+	for _, tt := range tests {
+		if got := resynchronise(tt.data); !bytes.Equal(got, tt.want) {
+			t.Errorf("resynchronise(%x) = %x, want %x", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestSynchsafeSize(t *testing.T) {
+	for _, size := range []int{0, 0x7f, 0x80, 0x3fff, 0x4000, 1<<28 - 1} {
+		b := make([]byte, 4)
+		putSynchsafeSize(b, size)
+		for _, c := range b {
+			if c&0x80 != 0 {
+				t.Errorf("putSynchsafeSize(%d) = %x", size, b)
+			}
+		}
+		if got := synchsafeSize(b); got != size {
+			t.Errorf("synchsafeSize(%x) = %d, want %d", b, got, size)
+		}
+	}
+}
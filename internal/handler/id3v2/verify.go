@@ -0,0 +1,158 @@
+package id3v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func (h *Id3v2Handler) VerifyFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(filePath) == ".dsf" {
+		return verifyDsf(file, stat.Size())
+	}
+	return verifyMpeg(file, stat.Size())
+}
+
+// DSFの各チャンクのサイズとメタデータチャンクの位置がファイルサイズと整合しているか確認する。
+func verifyDsf(r io.ReaderAt, fileSize int64) error {
+	header := make([]byte, 28)
+	_, err := r.ReadAt(header, 0)
+	if err != nil || string(header[:4]) != "DSD " {
+		return errors.New("DSDチャンクがありません。")
+	}
+
+	totalSize := int64(binary.LittleEndian.Uint64(header[12:20]))
+	if totalSize != fileSize {
+		return fmt.Errorf("DSDチャンクのファイルサイズが実際のサイズと一致しません。(%d / %d)", totalSize, fileSize)
+	}
+
+	format, err := readDsfFormat(r)
+	if err != nil {
+		return errors.New("fmtチャンクがありません。")
+	}
+
+	dataHeader := make([]byte, 12)
+	_, err = r.ReadAt(dataHeader, 28+52)
+	if err != nil || string(dataHeader[:4]) != "data" {
+		return errors.New("dataチャンクがありません。")
+	}
+
+	dataEnd := 28 + 52 + int64(binary.LittleEndian.Uint64(dataHeader[4:12]))
+
+	// サンプルはチャンネルごとのブロック単位で格納されている
+	if format.blockSize > 0 {
+		bytesPerChannel := (format.sampleCount*int64(format.bitsPerSample) + 7) / 8
+		blocks := (bytesPerChannel + int64(format.blockSize) - 1) / int64(format.blockSize)
+		expected := blocks * int64(format.blockSize) * int64(format.channels)
+		if dataEnd-(28+52+12) != expected {
+			return errors.New("dataチャンクのサイズがサンプル数と一致しません。")
+		}
+	}
+
+	pointer := int64(binary.LittleEndian.Uint64(header[20:28]))
+	if pointer == 0 {
+		if dataEnd != fileSize {
+			return errors.New("dataチャンクの後に不明なデータがあります。")
+		}
+		return nil
+	}
+
+	if pointer != dataEnd {
+		return errors.New("メタデータチャンクの位置がdataチャンクの終わりと一致しません。")
+	}
+
+	id3 := make([]byte, 3)
+	_, err = r.ReadAt(id3, pointer)
+	if err != nil || string(id3) != "ID3" {
+		return errors.New("メタデータチャンクの位置にID3v2タグがありません。")
+	}
+
+	return nil
+}
+
+// 先頭のフレームから順にフレームヘッダーをたどり、CRCがあれば照合する。
+// 末尾のID3v1タグとAPEタグは除く。
+func verifyMpeg(r io.ReaderAt, fileSize int64) error {
+	offset, end, err := findMpegAudio(r, fileSize)
+	if err != nil {
+		return err
+	}
+
+	frameCount := 0
+	buff := make([]byte, 4+2+32)
+	for offset < end {
+		n, _ := r.ReadAt(buff, offset)
+		header, ok := parseMpegFrameHeader(buff[:n])
+		if !ok {
+			return fmt.Errorf("%dバイト目にフレームがありません。", offset)
+		}
+
+		if offset+int64(header.frameSize()) > end {
+			return errors.New("最後のフレームが途中で切れています。")
+		}
+
+		if header.protected && header.layer == 3 {
+			sideInfo := buff[6 : 6+header.sideInfoSize()]
+			crc := mpegCrc16(append([]byte{buff[2], buff[3]}, sideInfo...))
+			if crc != binary.BigEndian.Uint16(buff[4:6]) {
+				return fmt.Errorf("%d番目のフレームのCRCが一致しません。", frameCount+1)
+			}
+		}
+
+		offset += int64(header.frameSize())
+		frameCount++
+	}
+
+	return nil
+}
+
+// 音声データの後にAPEv2タグがあればその開始位置を、なければendを返す。
+func findApeTagStart(r io.ReaderAt, end int64) int64 {
+	if end < 32 {
+		return end
+	}
+
+	footer := make([]byte, 32)
+	_, err := r.ReadAt(footer, end-32)
+	if err != nil || string(footer[:8]) != "APETAGEX" {
+		return end
+	}
+
+	size := int64(binary.LittleEndian.Uint32(footer[12:16]))
+	flags := binary.LittleEndian.Uint32(footer[20:24])
+	// ヘッダーがあればサイズに含まれていない
+	if flags&0x80000000 != 0 {
+		size += 32
+	}
+
+	return end - size
+}
+
+func mpegCrc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,84 @@
+package m4a
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/abema/go-mp4"
+)
+
+// 音声トラック(hdlrがsoun)のサンプルのSHA-256を返す。
+// フラグメント化されたファイルでは各trunが指すデータも含める。
+// チャプタートラックなどのサンプルは含めないので、区切りを書き直しても変わらない。
+func (h *M4aHandler) HashAudio(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return hashAudio(io.NewSectionReader(file, 0, stat.Size()))
+}
+
+func hashAudio(file *io.SectionReader) (string, error) {
+	traks, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak()})
+	if err != nil {
+		return "", errors.New("ファイルの構造を読み込めませんでした。")
+	}
+
+	moofs, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoof()})
+	if err != nil {
+		return "", errors.New("ファイルの構造を読み込めませんでした。")
+	}
+
+	chunks := []chunk{}
+	hasSoundTrack := false
+	for _, trak := range traks {
+		hdlrs, err := mp4.ExtractBoxWithPayload(file, trak, mp4.BoxPath{mp4.BoxTypeMdia(), mp4.BoxTypeHdlr()})
+		if err != nil {
+			return "", errors.New("ファイルの構造を読み込めませんでした。")
+		}
+		if len(hdlrs) == 0 {
+			continue
+		}
+		if hdlr, ok := hdlrs[0].Payload.(*mp4.Hdlr); !ok || hdlr.HandlerType != [4]byte{'s', 'o', 'u', 'n'} {
+			continue
+		}
+		hasSoundTrack = true
+
+		trakChunks, err := readChunks(file, trak)
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, trakChunks...)
+	}
+	if !hasSoundTrack {
+		return "", errors.New("音声トラックがありません。")
+	}
+
+	for _, moof := range moofs {
+		fragmentChunks, err := readFragmentChunks(file, moof)
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, fragmentChunks...)
+	}
+
+	hash := sha256.New()
+	for _, chunk := range chunks {
+		_, err = io.Copy(hash, io.NewSectionReader(file, int64(chunk.offset), int64(chunk.size)))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
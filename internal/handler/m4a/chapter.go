@@ -0,0 +1,128 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/abema/go-mp4"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// Neroのチャプターリスト。moov/udtaの下に置かれる。
+var boxTypeChpl mp4.BoxType = mp4.StrToBoxType("chpl")
+
+// chplの開始位置の単位
+const chplTimeUnit = 100 * time.Nanosecond
+
+// QuickTime形式のチャプタートラックから区切りを取得する。なければmoov/udta/chplから取得する。
+// どちらにもタイトルしかないので、アーティストは設定されない。
+func getChapters(file *os.File) []model.Chapter {
+	if chapters := getChapterTrackChapters(file); chapters != nil {
+		return chapters
+	}
+	return getChplChapters(file)
+}
+
+// moov/udta/chplから区切りを取得する。
+func getChplChapters(r io.ReadSeeker) []model.Chapter {
+	boxes, err := mp4.ExtractBox(r, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeUdta(), boxTypeChpl})
+	if err != nil || len(boxes) == 0 {
+		return nil
+	}
+
+	info := boxes[0]
+	data := make([]byte, info.Size-info.HeaderSize)
+	_, err = r.Seek(int64(info.Offset+info.HeaderSize), io.SeekStart)
+	if err != nil {
+		return nil
+	}
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil
+	}
+
+	return parseChpl(data)
+}
+
+func parseChpl(data []byte) []model.Chapter {
+	if len(data) < 5 {
+		return nil
+	}
+
+	// バージョン1ではバージョンとフラグの後に4バイトの予約領域がある
+	pos := 4
+	if data[0] != 0 {
+		pos += 4
+	}
+	if pos >= len(data) {
+		return nil
+	}
+
+	count := int(data[pos])
+	pos++
+
+	chapters := []model.Chapter{}
+	for i := 0; i < count && pos+9 <= len(data); i++ {
+		start := binary.BigEndian.Uint64(data[pos : pos+8])
+		length := int(data[pos+8])
+		pos += 9
+
+		if pos+length > len(data) {
+			break
+		}
+
+		chapters = append(chapters, model.Chapter{
+			Start: time.Duration(start) * chplTimeUnit,
+			Title: string(data[pos : pos+length]),
+		})
+		pos += length
+	}
+
+	return chapters
+}
+
+func addChapters(w *mp4.Writer, chapters []model.Chapter) error {
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	// 件数とタイトルの長さは1バイトで表す
+	if len(chapters) > 255 {
+		chapters = chapters[:255]
+	}
+
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(len(chapters))}
+	for _, chapter := range chapters {
+		title := truncateUTF8(chapter.Title, 255)
+		data = binary.BigEndian.AppendUint64(data, uint64(chapter.Start/chplTimeUnit))
+		data = append(data, byte(len(title)))
+		data = append(data, title...)
+	}
+
+	_, err := w.StartBox(&mp4.BoxInfo{Type: boxTypeChpl})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.EndBox()
+	return err
+}
+
+// 文字の途中で切れないように最大バイト数以下に切り詰める。
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
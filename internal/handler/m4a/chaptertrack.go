@@ -0,0 +1,477 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+	"unicode/utf16"
+
+	"github.com/abema/go-mp4"
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+// QuickTime形式のチャプタートラック。
+// 音声トラックのtref/chapが参照するテキストトラックで、サンプルごとに区切りのタイトルを持つ。
+type chapterTrack struct {
+	trackID   uint32
+	timescale uint32
+	// メディアの長さ(timescale単位)
+	duration uint64
+	samples  []chapterSample
+}
+
+type chapterSample struct {
+	offset uint64
+	size   uint32
+	// 開始位置(timescale単位)
+	start uint64
+}
+
+// moovボックス全体を読み込む。moovがなければnilを返す。
+func readMoov(file *os.File) ([]byte, error) {
+	boxes, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoov()})
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 {
+		return nil, nil
+	}
+
+	moov := make([]byte, boxes[0].Size)
+	_, err = file.ReadAt(moov, int64(boxes[0].Offset))
+	if err != nil {
+		return nil, err
+	}
+	return moov, nil
+}
+
+// チャプタートラックから区切りを取得する。チャプタートラックがなければnilを返す。
+// テキストにはタイトルしかないので、アーティストは設定されない。
+func getChapterTrackChapters(file *os.File) []model.Chapter {
+	moov, err := readMoov(file)
+	if err != nil || moov == nil {
+		return nil
+	}
+
+	chapterTrack := findChapterTrack(moov)
+	if chapterTrack == nil {
+		return nil
+	}
+
+	chapters := []model.Chapter{}
+	for _, sample := range chapterTrack.samples {
+		data := make([]byte, sample.size)
+		_, err = file.ReadAt(data, int64(sample.offset))
+		if err != nil {
+			return nil
+		}
+
+		chapters = append(chapters, model.Chapter{
+			Start: time.Duration(sample.start) * time.Second / time.Duration(chapterTrack.timescale),
+			Title: parseChapterText(data),
+		})
+	}
+	return chapters
+}
+
+// moovからチャプタートラックを探す。なければnilを返す。
+func findChapterTrack(moov []byte) *chapterTrack {
+	_, payload, _, err := splitBox(moov)
+	if err != nil {
+		return nil
+	}
+
+	trackID := findChapterTrackID(payload)
+	if trackID == 0 {
+		return nil
+	}
+
+	for _, trak := range findBoxes(payload, "trak") {
+		if getTrackID(trak) != trackID {
+			continue
+		}
+
+		mdhd := findBox(trak, "mdia", "mdhd")
+		stbl := findBox(trak, "mdia", "minf", "stbl")
+		if mdhd == nil || stbl == nil {
+			return nil
+		}
+
+		timescale, duration, ok := parseMdhd(mdhd)
+		if !ok || timescale == 0 {
+			return nil
+		}
+
+		samples, err := readChapterSamples(stbl)
+		if err != nil {
+			return nil
+		}
+
+		return &chapterTrack{trackID: trackID, timescale: timescale, duration: duration, samples: samples}
+	}
+
+	return nil
+}
+
+// いずれかのトラックのtref/chapが参照する最初のトラックIDを返す。なければ0を返す。
+func findChapterTrackID(moovPayload []byte) uint32 {
+	for _, trak := range findBoxes(moovPayload, "trak") {
+		chap := findBox(trak, "tref", "chap")
+		for i := 0; i+4 <= len(chap); i += 4 {
+			if trackID := binary.BigEndian.Uint32(chap[i:]); trackID != 0 {
+				return trackID
+			}
+		}
+	}
+	return 0
+}
+
+// trakのtkhdのトラックIDを返す。
+func getTrackID(trak []byte) uint32 {
+	tkhd := findBox(trak, "tkhd")
+	// バージョンとフラグの後に作成日時と更新日時(バージョン1では8バイトずつ)が続く
+	pos := 12
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		pos = 20
+	}
+	if len(tkhd) < pos+4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(tkhd[pos:])
+}
+
+// mdhdのtimescaleとdurationを返す。
+func parseMdhd(mdhd []byte) (uint32, uint64, bool) {
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		if len(mdhd) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(mdhd[20:]), binary.BigEndian.Uint64(mdhd[24:]), true
+	}
+	if len(mdhd) < 20 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(mdhd[12:]), uint64(binary.BigEndian.Uint32(mdhd[16:])), true
+}
+
+// stblのstts、stsc、stsz、stco / co64から各サンプルの位置、サイズ、開始位置を求める。
+func readChapterSamples(stbl []byte) ([]chapterSample, error) {
+	stts := findBox(stbl, "stts")
+	stsc := findBox(stbl, "stsc")
+	stsz := findBox(stbl, "stsz")
+	if stts == nil || stsc == nil || stsz == nil || len(stsz) < 12 {
+		return nil, errInvalidBox
+	}
+
+	// stszはサンプルのサイズが共通ならその値、異なればサンプルごとのサイズを持つ
+	sampleSize := binary.BigEndian.Uint32(stsz[4:])
+	sampleCount := int(binary.BigEndian.Uint32(stsz[8:]))
+	if sampleSize == 0 && sampleCount > (len(stsz)-12)/4 {
+		return nil, errInvalidBox
+	}
+	samples := make([]chapterSample, sampleCount)
+	for i := range samples {
+		samples[i].size = sampleSize
+		if sampleSize == 0 {
+			samples[i].size = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+
+	// sttsはサンプル数と1サンプルの長さのエントリの並び
+	start := uint64(0)
+	sample := 0
+	for _, entry := range tableEntries(stts, 8) {
+		count := int(binary.BigEndian.Uint32(entry))
+		delta := uint64(binary.BigEndian.Uint32(entry[4:]))
+		for j := 0; j < count && sample < len(samples); j++ {
+			samples[sample].start = start
+			start += delta
+			sample++
+		}
+	}
+
+	var offsets []uint64
+	if stco := findBox(stbl, "stco"); stco != nil {
+		for _, entry := range tableEntries(stco, 4) {
+			offsets = append(offsets, uint64(binary.BigEndian.Uint32(entry)))
+		}
+	} else if co64 := findBox(stbl, "co64"); co64 != nil {
+		for _, entry := range tableEntries(co64, 8) {
+			offsets = append(offsets, binary.BigEndian.Uint64(entry))
+		}
+	} else {
+		return nil, errInvalidBox
+	}
+
+	// stscは最初のチャンク番号(1から)とチャンクごとのサンプル数のエントリの並び
+	stscEntries := tableEntries(stsc, 12)
+	sample = 0
+	for i, offset := range offsets {
+		samplesPerChunk := 0
+		for _, entry := range stscEntries {
+			if int(binary.BigEndian.Uint32(entry)) <= i+1 {
+				samplesPerChunk = int(binary.BigEndian.Uint32(entry[4:]))
+			}
+		}
+
+		for j := 0; j < samplesPerChunk && sample < len(samples); j++ {
+			samples[sample].offset = offset
+			offset += uint64(samples[sample].size)
+			sample++
+		}
+	}
+	if sample != len(samples) {
+		return nil, errInvalidBox
+	}
+
+	return samples, nil
+}
+
+// バージョンとフラグ、エントリー数の後に続く固定長のエントリーを返す。
+// エントリー数がデータに収まらなければ収まる分だけを返す。
+func tableEntries(payload []byte, entrySize int) [][]byte {
+	if len(payload) < 8 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(payload[4:]))
+	count = min(count, (len(payload)-8)/entrySize)
+
+	entries := make([][]byte, count)
+	for i := range entries {
+		entries[i] = payload[8+i*entrySize : 8+(i+1)*entrySize]
+	}
+	return entries
+}
+
+// チャプターのサンプルのテキストを読み込む。
+// 先頭の2バイトがテキストの長さで、BOMがあればUTF-16、なければUTF-8。
+func parseChapterText(data []byte) string {
+	if len(data) < 2 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	text := data[2:min(2+length, len(data))]
+
+	if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+		units := make([]uint16, (len(text)-2)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(text[2+i*2:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(text)
+}
+
+// テキストがUTF-8であることを表すencdボックス
+var encdBox = []byte{0, 0, 0, 12, 'e', 'n', 'c', 'd', 0, 0, 1, 0}
+
+// 区切りからチャプタートラックのサンプルを作成する。
+// 最初の区切りはトラックの先頭から始め、最後の区切りはトラックの終わりまでとする。
+func newChapterSamples(chapters []model.Chapter, timescale uint32, duration uint64) ([]byte, []uint32, []uint32) {
+	data := []byte{}
+	sizes := make([]uint32, len(chapters))
+	deltas := make([]uint32, len(chapters))
+
+	starts := make([]uint64, len(chapters))
+	for i, chapter := range chapters {
+		if i > 0 {
+			starts[i] = max(uint64(chapter.Start*time.Duration(timescale)/time.Second), starts[i-1])
+		}
+	}
+
+	for i, chapter := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = starts[i+1]
+		}
+		if end < starts[i] {
+			end = starts[i]
+		}
+		deltas[i] = uint32(end - starts[i])
+
+		title := truncateUTF8(chapter.Title, 0xffff)
+		sample := binary.BigEndian.AppendUint16(nil, uint16(len(title)))
+		sample = append(sample, title...)
+		sample = append(sample, encdBox...)
+
+		data = append(data, sample...)
+		sizes[i] = uint32(len(sample))
+	}
+
+	return data, sizes, deltas
+}
+
+// チャプタートラックのサンプルを区切りから作成し直す。
+// 新しいサンプルは1つのチャンクとしてchunkOffsetの位置に置くものとして、サンプルテーブルを書き換えたmoovと
+// サンプルのデータを返す。チャプタートラックがなければmoovをそのまま返し、データはnilになる。
+func rewriteChapterTrack(moov []byte, chapters []model.Chapter, chunkOffset uint64) ([]byte, []byte, error) {
+	chapterTrack := findChapterTrack(moov)
+	if chapterTrack == nil {
+		return moov, nil, nil
+	}
+
+	data, sizes, deltas := newChapterSamples(chapters, chapterTrack.timescale, chapterTrack.duration)
+
+	_, payload, _, err := splitBox(moov)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isChapterTrak := func(boxType string, payload []byte) bool {
+		return boxType != "trak" || getTrackID(payload) == chapterTrack.trackID
+	}
+	payload, err = editBox(payload, []string{"trak", "mdia", "minf", "stbl"}, isChapterTrak, func(stbl []byte) ([]byte, error) {
+		return newChapterSampleTables(stbl, sizes, deltas, chunkOffset)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newBox("moov", payload), data, nil
+}
+
+// サンプルの並びに関するボックスのうち、チャプタートラックで作成し直さないもの。
+// サンプル数が変わると不正になるので取り除く。
+var sampleDependentBoxes = []string{"stss", "ctts", "stps", "sdtp", "sbgp", "subs", "stz2"}
+
+// stblのサンプルテーブルを、すべてのサンプルを1つのチャンクに置いたものに書き換える。
+func newChapterSampleTables(stbl []byte, sizes []uint32, deltas []uint32, chunkOffset uint64) ([]byte, error) {
+	stts := fullBoxHeader(len(deltas))
+	for _, delta := range deltas {
+		stts = binary.BigEndian.AppendUint32(stts, 1)
+		stts = binary.BigEndian.AppendUint32(stts, delta)
+	}
+
+	stsc := fullBoxHeader(0)
+	co64 := fullBoxHeader(0)
+	if len(sizes) > 0 {
+		stsc = fullBoxHeader(1)
+		stsc = binary.BigEndian.AppendUint32(stsc, 1)
+		stsc = binary.BigEndian.AppendUint32(stsc, uint32(len(sizes)))
+		stsc = binary.BigEndian.AppendUint32(stsc, 1)
+
+		co64 = fullBoxHeader(1)
+		co64 = binary.BigEndian.AppendUint64(co64, chunkOffset)
+	}
+
+	// stszはサンプルのサイズを0にしてサンプルごとのサイズを持たせる
+	stsz := fullBoxHeader(0)
+	stsz = binary.BigEndian.AppendUint32(stsz, uint32(len(sizes)))
+	for _, size := range sizes {
+		stsz = binary.BigEndian.AppendUint32(stsz, size)
+	}
+
+	result := []byte{}
+	for len(stbl) > 0 {
+		boxType, _, size, err := splitBox(stbl)
+		if err != nil {
+			return nil, err
+		}
+
+		switch boxType {
+		case "stts":
+			result = append(result, newBox(boxType, stts)...)
+		case "stsc":
+			result = append(result, newBox(boxType, stsc)...)
+		case "stsz":
+			result = append(result, newBox(boxType, stsz)...)
+		case "stco", "co64":
+			result = append(result, newBox("co64", co64)...)
+		default:
+			if !slices.Contains(sampleDependentBoxes, boxType) {
+				result = append(result, stbl[:size]...)
+			}
+		}
+
+		stbl = stbl[size:]
+	}
+
+	return result, nil
+}
+
+// バージョン0、フラグ0のフルボックスのヘッダーとエントリー数を返す。
+func fullBoxHeader(entryCount int) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, uint32(entryCount))
+}
+
+// 区切りを書き込むファイルの最後のボックスのサイズが0(ファイルの終わりまで)なら、
+// 後ろにボックスを追加できないのでエラーを返す。
+func checkAppendable(file *os.File, last mp4.BoxInfo) error {
+	size := make([]byte, 4)
+	_, err := file.ReadAt(size, int64(last.Offset))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if binary.BigEndian.Uint32(size) == 0 {
+		return errors.New("最後のボックスがファイルの終わりまで続いているので、チャプタートラックを書き込めません。")
+	}
+	return nil
+}
+
+// ボックスの並びからpathの種類のボックスを順にたどり、最後のボックスのペイロードを返す。なければnilを返す。
+func findBox(data []byte, path ...string) []byte {
+	for _, payload := range findBoxes(data, path[0]) {
+		if len(path) == 1 {
+			return payload
+		}
+		if found := findBox(payload, path[1:]...); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// ボックスの並びから指定した種類のボックスのペイロードをすべて返す。
+func findBoxes(data []byte, boxType string) [][]byte {
+	payloads := [][]byte{}
+	for len(data) > 0 {
+		t, payload, size, err := splitBox(data)
+		if err != nil {
+			break
+		}
+		if t == boxType {
+			payloads = append(payloads, payload)
+		}
+		data = data[size:]
+	}
+	return payloads
+}
+
+// ボックスの並びからpathの種類のボックスを順にたどり、最後のボックスのペイロードをeditで置き換えた並びを返す。
+// 途中のボックスのサイズも合わせて更新する。acceptがfalseを返したボックスはたどらない。
+func editBox(data []byte, path []string, accept func(boxType string, payload []byte) bool, edit func([]byte) ([]byte, error)) ([]byte, error) {
+	result := []byte{}
+	for len(data) > 0 {
+		boxType, payload, size, err := splitBox(data)
+		if err != nil {
+			return nil, err
+		}
+
+		box := data[:size]
+		if boxType == path[0] && accept(boxType, payload) {
+			if len(path) == 1 {
+				payload, err = edit(payload)
+			} else {
+				payload, err = editBox(payload, path[1:], accept, edit)
+			}
+			if err != nil {
+				return nil, err
+			}
+			box = newBox(boxType, payload)
+		}
+
+		result = append(result, box...)
+		data = data[size:]
+	}
+	return result, nil
+}
+
+// ペイロードにヘッダーを付けたボックスを返す。
+func newBox(boxType string, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	box = append(box, boxType...)
+	return append(box, payload...)
+}
@@ -0,0 +1,234 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// テスト用のファイル(moovがファイルの最後にある)を一時ディレクトリにコピーする。
+func copyTestFile(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.m4a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(t.TempDir(), "sample.m4a")
+	err = os.WriteFile(filePath, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// 最上位のボックスをペイロード付きで分割する。
+func splitTopLevelBoxes(t *testing.T, data []byte) (types []string, boxes [][]byte) {
+	t.Helper()
+
+	for len(data) > 0 {
+		boxType, _, size, err := splitBox(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, boxType)
+		boxes = append(boxes, data[:size])
+		data = data[size:]
+	}
+	return types, boxes
+}
+
+// テキストトラックのtrakを作成する。サンプルは1つのチャンクにまとめてchunkOffsetに置く。
+func newTextTrak(trackID uint32, timescale uint32, deltas []uint32, sizes []uint32, chunkOffset uint32) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[12:], trackID)
+
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:], timescale)
+	duration := uint32(0)
+	for _, delta := range deltas {
+		duration += delta
+	}
+	binary.BigEndian.PutUint32(mdhd[16:], duration)
+
+	hdlr := make([]byte, 25)
+	copy(hdlr[8:], "text")
+
+	stts := fullBoxHeader(len(deltas))
+	for _, delta := range deltas {
+		stts = binary.BigEndian.AppendUint32(stts, 1)
+		stts = binary.BigEndian.AppendUint32(stts, delta)
+	}
+	stsc := binary.BigEndian.AppendUint32(fullBoxHeader(1), 1)
+	stsc = binary.BigEndian.AppendUint32(stsc, uint32(len(sizes)))
+	stsc = binary.BigEndian.AppendUint32(stsc, 1)
+	stsz := binary.BigEndian.AppendUint32(fullBoxHeader(0), uint32(len(sizes)))
+	for _, size := range sizes {
+		stsz = binary.BigEndian.AppendUint32(stsz, size)
+	}
+	stco := binary.BigEndian.AppendUint32(fullBoxHeader(1), chunkOffset)
+
+	stbl := newBox("stsd", fullBoxHeader(0))
+	stbl = append(stbl, newBox("stts", stts)...)
+	stbl = append(stbl, newBox("stsc", stsc)...)
+	stbl = append(stbl, newBox("stsz", stsz)...)
+	stbl = append(stbl, newBox("stco", stco)...)
+
+	mdia := newBox("mdhd", mdhd)
+	mdia = append(mdia, newBox("hdlr", hdlr)...)
+	mdia = append(mdia, newBox("minf", newBox("stbl", stbl))...)
+
+	trak := newBox("tkhd", tkhd)
+	trak = append(trak, newBox("mdia", mdia)...)
+	return newBox("trak", trak)
+}
+
+// テスト用のファイルに、音声トラックから参照するチャプタートラックを追加する。
+func addChapterTrack(t *testing.T, filePath string, titles []string, deltas []uint32) {
+	t.Helper()
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types, boxes := splitTopLevelBoxes(t, data)
+	if types[len(types)-1] != "moov" {
+		t.Fatalf("moovが最後にない: %v", types)
+	}
+	prefix := data[:len(data)-len(boxes[len(boxes)-1])]
+	_, moovPayload, _, _ := splitBox(boxes[len(boxes)-1])
+
+	samples := []byte{}
+	sizes := []uint32{}
+	for _, title := range titles {
+		sample := binary.BigEndian.AppendUint16(nil, uint16(len(title)))
+		sample = append(sample, title...)
+		samples = append(samples, sample...)
+		sizes = append(sizes, uint32(len(sample)))
+	}
+
+	// 音声トラック(トラックID 2)からトラックID 3を参照する
+	isSoundTrak := func(boxType string, payload []byte) bool {
+		return boxType != "trak" || getTrackID(payload) == 2
+	}
+	moovPayload, err = editBox(moovPayload, []string{"trak"}, isSoundTrak, func(trak []byte) ([]byte, error) {
+		tref := newBox("tref", newBox("chap", binary.BigEndian.AppendUint32(nil, 3)))
+		return append(append([]byte{}, trak...), tref...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// チャンクの位置はmoovのサイズで決まり、moovのサイズは位置の値によらない
+	moov := newBox("moov", append(moovPayload, newTextTrak(3, 1000, deltas, sizes, 0)...))
+	chunkOffset := uint32(len(prefix) + len(moov) + 8)
+	moov = newBox("moov", append(moovPayload, newTextTrak(3, 1000, deltas, sizes, chunkOffset)...))
+
+	data = append(append(prefix, moov...), newBox("mdat", samples)...)
+	err = os.WriteFile(filePath, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readChapters(t *testing.T, filePath string) []model.Chapter {
+	t.Helper()
+
+	track, err := (&M4aHandler{}).ReadTrack(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return track.Chapters
+}
+
+func TestChapterTrack(t *testing.T) {
+	filePath := copyTestFile(t)
+	addChapterTrack(t, filePath, []string{"Intro", "本編"}, []uint32{500, 500})
+
+	want := []model.Chapter{{Start: 0, Title: "Intro"}, {Start: 500 * time.Millisecond, Title: "本編"}}
+	if got := readChapters(t, filePath); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Chapters = %v, want %v", got, want)
+	}
+
+	h := &M4aHandler{}
+	conf := config.Default()
+	audioHash, err := h.HashAudio(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		chapters []model.Chapter
+		want     []model.Chapter
+	}{
+		{
+			name:     "区切りを読み込んでいなければそのまま残す",
+			chapters: nil,
+			want:     want,
+		},
+		{
+			name:     "区切りを書き直す",
+			chapters: []model.Chapter{{Start: 0, Title: "A"}, {Start: 300 * time.Millisecond, Title: "B"}, {Start: 600 * time.Millisecond, Title: "C"}},
+			want:     []model.Chapter{{Start: 0, Title: "A"}, {Start: 300 * time.Millisecond, Title: "B"}, {Start: 600 * time.Millisecond, Title: "C"}},
+		},
+		{
+			name:     "最初の区切りはトラックの先頭から始める",
+			chapters: []model.Chapter{{Start: 100 * time.Millisecond, Title: "X"}, {Start: 400 * time.Millisecond, Title: "Y"}},
+			want:     []model.Chapter{{Start: 0, Title: "X"}, {Start: 400 * time.Millisecond, Title: "Y"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &model.Track{FilePath: filePath, Title: "title", Chapters: tt.chapters}
+			err := h.WriteTrack(track, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := readChapters(t, filePath); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Chapters = %v, want %v", got, tt.want)
+			}
+
+			// チャプタートラックのサンプルは音声データのハッシュに含めない
+			if got, err := h.HashAudio(filePath); err != nil || got != audioHash {
+				t.Errorf("HashAudio = %s, %v", got, err)
+			}
+
+			err = h.VerifyFile(filePath)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestParseChapterText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"UTF-8", []byte{0, 5, 'I', 'n', 't', 'r', 'o'}, "Intro"},
+		{"encdが続く", append([]byte{0, 2, 'A', 'B'}, encdBox...), "AB"},
+		{"UTF-16", []byte{0, 6, 0xfe, 0xff, 0x30, 0x42, 0x30, 0x44}, "あい"},
+		{"長さが足りない", []byte{0, 10, 'A'}, "A"},
+		{"空", []byte{0}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChapterText(tt.data); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"net/http"
+	"unicode/utf16"
+)
+
+// dataボックスの型(well-known type)。
+// go-mp4の定数はJPEGとPNGの値が仕様と異なるので使わない。
+const (
+	dataTypeImplicit = 0
+	dataTypeUTF8     = 1
+	dataTypeUTF16    = 2
+	dataTypeJPEG     = 13
+	dataTypePNG      = 14
+	// 符号付き整数(ビッグエンディアン)
+	dataTypeInteger = 21
+	dataTypeBMP     = 27
+)
+
+// dataボックスの中身を型に従って文字列にする。
+func decodeText(dataType uint32, data []byte) string {
+	if dataType != dataTypeUTF16 {
+		return string(data)
+	}
+
+	// UTF-16はビッグエンディアン
+	codes := make([]uint16, len(data)/2)
+	for i := range codes {
+		codes[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(codes))
+}
+
+func isTextDataType(dataType uint32) bool {
+	return dataType == dataTypeUTF8 || dataType == dataTypeUTF16
+}
+
+// アートワークの型からMIMEタイプを返す。
+// 型が指定されていなければ中身から判定する。
+func imageMimeType(dataType uint32, data []byte) string {
+	switch dataType {
+	case dataTypeJPEG:
+		return "image/jpeg"
+	case dataTypePNG:
+		return "image/png"
+	case dataTypeBMP:
+		return "image/bmp"
+	default:
+		return http.DetectContentType(data)
+	}
+}
+
+// MIMEタイプからアートワークの型を返す。
+func imageDataType(mimeType string, data []byte) uint32 {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	switch mimeType {
+	case "image/jpeg", "image/jpg":
+		return dataTypeJPEG
+	case "image/png":
+		return dataTypePNG
+	case "image/bmp":
+		return dataTypeBMP
+	default:
+		return dataTypeImplicit
+	}
+}
+
+// trknとdiskは予約の2バイトの後に番号と総数が2バイトずつ続く。
+func parseNumberAndTotal(data []byte) (int, int) {
+	if len(data) < 6 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint16(data[2:4])), int(binary.BigEndian.Uint16(data[4:6]))
+}
+
+// trknは末尾に予約の2バイトがあり8バイト、diskは6バイトになる。
+func formatNumberAndTotal(name string, number int, total int) []byte {
+	size := 8
+	if name == "disk" {
+		size = 6
+	}
+
+	data := make([]byte, size)
+	binary.BigEndian.PutUint16(data[2:4], uint16(number))
+	binary.BigEndian.PutUint16(data[4:6], uint16(total))
+	return data
+}
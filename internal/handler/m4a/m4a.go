@@ -3,11 +3,17 @@ package m4a
 import (
 	"bytes"
 	"encoding/binary"
-	"net/http"
+	"errors"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/abema/go-mp4"
+	"github.com/solidcopy/utag/internal/atomicfile"
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/handler/id3v1"
 	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
@@ -23,9 +29,15 @@ func (h *M4aHandler) ReadTrack(filePath string) (*model.Track, error) {
 	track := &model.Track{FilePath: filePath}
 
 	parents := []string{"moov", "udta", "meta", "ilst"}
-	target := []string{"(c)nam", "(c)ART", "(c)alb", "(c)day", "aART", "trkn", "disk", "covr"}
+	target := []string{"(c)nam", "(c)ART", "(c)alb", "(c)day", "aART", "trkn", "disk", "covr", "soal", "soaa", "sonm", "soar", "(c)gen", "cpil", "----"}
 
 	var itemName string
+	// ----の場合はmeanとname子ボックスの値がタグの名前になる
+	var freeformMean, freeformName string
+	// gnreのID3v1のジャンル番号から求めたジャンル。(c)genがなければ使う
+	var standardGenre string
+	// (c)ARTの表示用のアーティスト名。ARTISTSがなければ使う
+	var displayArtists []string
 
 	_, err = mp4.ReadBoxStructure(file, func(h *mp4.ReadHandle) (interface{}, error) {
 
@@ -35,37 +47,99 @@ func (h *M4aHandler) ReadTrack(filePath string) (*model.Track, error) {
 
 			if slices.Contains(parents, typeName) || slices.Contains(target, typeName) {
 				itemName = typeName
+				freeformMean = ""
+				freeformName = ""
 				return h.Expand()
 			}
 
+			// go-mp4はgnreを3GPPのudtaの文字列のボックスとして解析してしまうので、dataボックスを直接読む
+			if typeName == "gnre" && len(h.Path) >= 2 && h.Path[len(h.Path)-2].String() == "ilst" {
+				buff := new(bytes.Buffer)
+				_, err := h.ReadData(buff)
+				if err != nil {
+					return nil, err
+				}
+
+				// dataボックスのヘッダー(8バイト)、データの型とロケール(8バイト)、ID3v1のジャンル番号に1を足した値
+				data := buff.Bytes()
+				if len(data) >= 18 && string(data[4:8]) == "data" {
+					standardGenre = id3v1.GenreName(int(binary.BigEndian.Uint16(data[16:])) - 1)
+				}
+				return nil, nil
+			}
+
+			if (typeName == "mean" || typeName == "name") && itemName == "----" {
+				buff := new(bytes.Buffer)
+				_, err := h.ReadData(buff)
+				if err != nil {
+					return nil, err
+				}
+
+				// 最初の4バイトはバージョンとフラグ
+				if buff.Len() < 4 {
+					return nil, nil
+				}
+				if typeName == "mean" {
+					freeformMean = string(buff.Bytes()[4:])
+				} else {
+					freeformName = string(buff.Bytes()[4:])
+				}
+			}
+
 			if typeName == "data" {
 
 				buff := new(bytes.Buffer)
-				h.ReadData(buff)
+				_, err := h.ReadData(buff)
+				if err != nil {
+					return nil, err
+				}
 
-				// 最初の8バイトはデータ本体ではなさそうなので削除
+				// 最初の4バイトはデータの型、次の4バイトはロケール
+				if buff.Len() < 8 {
+					return nil, nil
+				}
+				dataType := binary.BigEndian.Uint32(buff.Bytes()) & 0xffffff
 				data := buff.Bytes()[8:]
+				text := decodeText(dataType, data)
 
 				switch itemName {
 				case "(c)nam":
-					track.Title = string(data)
+					track.Title = text
 				case "(c)ART":
-					track.Artists = append(track.Artists, string(data))
+					displayArtists = append(displayArtists, text)
 				case "(c)alb":
-					track.Album = string(data)
+					track.Album = text
 				case "(c)day":
-					track.Date = string(data)
+					// 録音日(なければ発売日)。発売日と合わせて後で設定し直す
+					track.RecordingDate = text
 				case "aART":
-					track.AlbumArtist = string(data)
+					track.AlbumArtist = text
 				case "trkn":
-					track.TrackNumber = int(binary.BigEndian.Uint16(data[2:4]))
-					track.TotalTracks = int(binary.BigEndian.Uint16(data[4:6]))
+					track.TrackNumber, track.TotalTracks = parseNumberAndTotal(data)
 				case "disk":
-					track.DiscNumber = int(binary.BigEndian.Uint16(data[2:4]))
-					track.TotalDiscs = int(binary.BigEndian.Uint16(data[4:6]))
+					track.DiscNumber, track.TotalDiscs = parseNumberAndTotal(data)
 				case "covr":
-					mimeType := http.DetectContentType(data)
-					track.Image = &model.Image{MimeType: mimeType, Data: data}
+					// 複数のアートワークがあれば最初のものを使う
+					if track.Image == nil {
+						track.Image = &model.Image{MimeType: imageMimeType(dataType, data), Data: data}
+					}
+				case "soal":
+					track.AlbumSort = text
+				case "soaa":
+					track.AlbumArtistSort = text
+				case "sonm":
+					track.TitleSort = text
+				case "soar":
+					track.ArtistSort = text
+				case "(c)gen":
+					track.Genres = append(track.Genres, text)
+				case "cpil":
+					track.Compilation = slices.ContainsFunc(data, func(b byte) bool { return b != 0 })
+				case "----":
+					// テキスト以外の値は読み込まない
+					if isTextDataType(dataType) {
+						setFreeformTag(track, freeformMean, freeformName, text)
+					}
 				}
 			}
 		}
@@ -76,31 +150,214 @@ func (h *M4aHandler) ReadTrack(filePath string) (*model.Track, error) {
 		return nil, err
 	}
 
+	track.SetDates(track.RecordingDate, track.Date)
+
+	if len(track.Artists) == 0 {
+		track.Artists = displayArtists
+	}
+
+	if len(track.Genres) == 0 && standardGenre != "" {
+		track.Genres = []string{standardGenre}
+	}
+
+	track.Chapters = getChapters(file)
+	track.Stream = getStreamInfo(file)
+
 	return track, nil
 }
 
-func (h *M4aHandler) WriteTrack(track *model.Track) error {
+// iTunesの----のmean
+const itunesMean = "com.apple.iTunes"
+
+// ----:{mean}:{name}の値をトラックに設定する。
+// 決まった項目以外はタグの名前をキーにしてCustomに設定する。
+func setFreeformTag(track *model.Track, mean string, name string, value string) {
+	if mean != itunesMean {
+		track.AddCustom(mean+":"+name, value)
+		return
+	}
+
+	switch name {
+	case "ARTISTS":
+		track.Artists = append(track.Artists, value)
+	case "MusicBrainz Album Id":
+		track.MusicBrainzAlbumID = value
+	case "MusicBrainz Release Group Id":
+		track.MusicBrainzReleaseGroupID = value
+	case "MusicBrainz Album Artist Id":
+		track.MusicBrainzAlbumArtistIDs = append(track.MusicBrainzAlbumArtistIDs, value)
+	case "MusicBrainz Track Id":
+		track.MusicBrainzTrackID = value
+	case "MusicBrainz Release Track Id":
+		track.MusicBrainzReleaseTrackID = value
+	case "MusicBrainz Artist Id":
+		track.MusicBrainzArtistIDs = append(track.MusicBrainzArtistIDs, value)
+	case "UTAG_AUDIO_SHA256":
+		track.AudioHash = value
+	case "RELEASEDATE":
+		track.Date = value
+	case "ORIGINALDATE":
+		track.OriginalDate = value
+	default:
+		track.AddCustom(name, value)
+	}
+}
+
+func (h *M4aHandler) WriteTrack(track *model.Track, conf *config.Config) error {
 
 	file, err := os.Open(track.FilePath)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	newFilePath := track.FilePath + ".utag_temp"
-	newFile, err := os.OpenFile(newFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	stat, err := file.Stat()
 	if err != nil {
 		return err
 	}
+	fileSize := stat.Size()
 
-	w := mp4.NewWriter(newFile)
+	// 書き込んだ後の音声データのハッシュを、置き換えや上書きの前に元のハッシュと比較する
+	audioHash, err := hashAudio(io.NewSectionReader(file, 0, fileSize))
+	if err != nil {
+		return err
+	}
 
-	metaBoxes, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeUdta(), mp4.BoxTypeMeta()})
+	moov, boxes, err := rewriteMoov(file, track, conf)
+	if err != nil {
+		return err
+	}
+
+	first, last := findMoovRegion(boxes)
+	if first < 0 {
+		return errors.New("M4Aファイルの形式が不正です。")
+	}
+
+	// 区切りが読み込まれていて、チャプタートラックがあればそのサンプルも書き直す。
+	// 新しいサンプルはファイルの最後に追加するmdatに置くので、元のファイル上ではその中身の先頭を指すようにしておく
+	var chapterData []byte
+	if track.Chapters != nil {
+		fileEnd := boxes[len(boxes)-1].Offset + boxes[len(boxes)-1].Size
+		moov, chapterData, err = rewriteChapterTrack(moov, track.Chapters, fileEnd+8)
+		if err != nil {
+			return err
+		}
+		if chapterData != nil {
+			err = checkAppendable(file, boxes[len(boxes)-1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// moovと直後の余白の領域に収まれば、その部分だけを書き換える
+	start := int64(boxes[first].Offset)
+	available := int64(boxes[last].Offset+boxes[last].Size) - start
+	size := int64(len(moov))
+	if chapterData == nil && (size == available || size+8 <= available) {
+		data := append(moov, newFreeBox(available-size)...)
+
+		err = atomicfile.CheckHash(atomicfile.Patch(file, fileSize, data, start), hashAudio, audioHash)
+		if err != nil {
+			return err
+		}
+
+		file.Close()
+		return atomicfile.WriteAt(track.FilePath, data, start)
+	}
+
+	// moovの後のボックスは、moovと余白のサイズが変わった分だけ位置がずれる
+	padding := newFreeBox(8 + int64(conf.ImportPadding))
+	end := uint64(start + available)
+	delta := size + int64(len(padding)) - available
+	shift := func(offset uint64) uint64 {
+		if offset >= end {
+			return uint64(int64(offset) + delta)
+		}
+		return offset
+	}
+
+	// moovがmdatより前にあれば、チャンクの位置を更新する
+	err = shiftOffsets(moov, shift)
+	if err != nil {
+		return err
+	}
+
+	// 元のファイルは変更せず、一時ファイルに書き込んでから置き換える
+	newFile, err := atomicfile.Create(track.FilePath)
 	if err != nil {
 		return err
 	}
+	defer newFile.Abort()
+
+	for i, box := range boxes {
+		switch {
+		case i == first:
+			_, err = newFile.Write(moov)
+			if err == nil {
+				_, err = newFile.Write(padding)
+			}
+		case first < i && i <= last:
+			// 既存の余白は新しい余白に置き換える
+		case box.Type == mp4.BoxTypeMoof() || box.Type == mp4.BoxTypeSidx() || box.Type == mp4.BoxTypeMfra():
+			// フラグメント化されたファイルのボックスも位置を更新する
+			err = copyShiftedBox(newFile, file, box, shift)
+		default:
+			_, err = io.Copy(newFile, io.NewSectionReader(file, int64(box.Offset), int64(box.Size)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if chapterData != nil {
+		_, err = newFile.Write(newBox("mdat", chapterData))
+		if err != nil {
+			return err
+		}
+	}
+
+	file.Close()
+
+	content, err := newFile.Content()
+	if err != nil {
+		return err
+	}
+	err = atomicfile.CheckHash(content, hashAudio, audioHash)
+	if err != nil {
+		return err
+	}
+
+	return newFile.Commit()
+}
+
+// タグを書き直したmoovボックスを返す。
+// 合わせてファイルの最上位のボックスの一覧を返す。
+func rewriteMoov(file *os.File, track *model.Track, conf *config.Config) ([]byte, []mp4.BoxInfo, error) {
+	moov := &memoryWriter{}
+	w := mp4.NewWriter(moov)
+
+	boxes := []mp4.BoxInfo{}
+
+	covers, err := readCovers(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metaBoxes, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeUdta(), mp4.BoxTypeMeta()})
+	if err != nil {
+		return nil, nil, err
+	}
 	noMetaBox := len(metaBoxes) == 0
 
 	_, err = mp4.ReadBoxStructure(file, func(h *mp4.ReadHandle) (interface{}, error) {
+		if len(h.Path) == 1 {
+			boxes = append(boxes, h.BoxInfo)
+			if h.BoxInfo.Type != mp4.BoxTypeMoov() {
+				return nil, nil
+			}
+		}
+
 		switch h.BoxInfo.Type {
 		case mp4.BoxTypeMoov(), mp4.BoxTypeUdta(), mp4.BoxTypeMeta():
 			_, err := w.StartBox(&h.BoxInfo)
@@ -140,14 +397,38 @@ func (h *M4aHandler) WriteTrack(track *model.Track) error {
 
 				addStringTag(w, "\251alb", track.Album)
 				addStringTag(w, "aART", track.AlbumArtist)
-				addStringTag(w, "\251day", track.Date)
+				if track.Compilation {
+					addIntegerTag(w, "cpil", 1)
+				}
+				addStringTag(w, "\251day", track.DisplayDate())
 				addNumberAndTotalTag(w, "trkn", track.TrackNumber, track.TotalTracks)
 				addNumberAndTotalTag(w, "disk", track.DiscNumber, track.TotalDiscs)
 				addStringTag(w, "\251nam", track.Title)
-				for _, artist := range track.Artists {
-					addStringTag(w, "\251ART", artist)
+				// ©ARTには表示用のアーティスト名を設定し、複数のアーティストはARTISTSにも設定する
+				addStringTag(w, "\251ART", track.DisplayArtist(conf.ArtistSeparator, conf.MergeAlbumArtist))
+				for _, genre := range track.Genres {
+					addStringTag(w, "\251gen", genre)
+				}
+				addCoverTag(w, track.Image, covers)
+				addSortTag(w, "soal", track.AlbumSort)
+				addSortTag(w, "soaa", track.AlbumArtistSort)
+				addSortTag(w, "sonm", track.TitleSort)
+				addSortTag(w, "soar", track.ArtistSort)
+				if artists := track.TagArtists(conf.MergeAlbumArtist); len(artists) > 1 {
+					addFreeformTag(w, itunesMean, "ARTISTS", artists...)
 				}
-				addBytesTag(w, "covr", track.Image.Data)
+				addFreeformTag(w, itunesMean, "MusicBrainz Album Id", track.MusicBrainzAlbumID)
+				addFreeformTag(w, itunesMean, "MusicBrainz Release Group Id", track.MusicBrainzReleaseGroupID)
+				addFreeformTag(w, itunesMean, "MusicBrainz Album Artist Id", track.MusicBrainzAlbumArtistIDs...)
+				addFreeformTag(w, itunesMean, "MusicBrainz Track Id", track.MusicBrainzTrackID)
+				addFreeformTag(w, itunesMean, "MusicBrainz Release Track Id", track.MusicBrainzReleaseTrackID)
+				addFreeformTag(w, itunesMean, "MusicBrainz Artist Id", track.MusicBrainzArtistIDs...)
+				addFreeformTag(w, itunesMean, "UTAG_AUDIO_SHA256", track.AudioHash)
+				if track.RecordingDate != "" {
+					addFreeformTag(w, itunesMean, "RELEASEDATE", track.Date)
+				}
+				addFreeformTag(w, itunesMean, "ORIGINALDATE", track.OriginalDate)
+				addCustomTags(w, track.Custom)
 
 				_, err = w.EndBox()
 				if err != nil {
@@ -167,27 +448,122 @@ func (h *M4aHandler) WriteTrack(track *model.Track) error {
 				return nil, err
 			}
 
+			// 区切りが読み込まれていれば既存のchplの代わりに書き込む
+			if h.BoxInfo.Type == mp4.BoxTypeUdta() && track.Chapters != nil {
+				err = addChapters(w, track.Chapters)
+				if err != nil {
+					return nil, err
+				}
+			}
+
 			_, err = w.EndBox()
 			return nil, err
 
 		case mp4.BoxTypeIlst():
 			return nil, nil
+		case mp4.BoxTypeFree(), mp4.BoxTypeSkip():
+			// moovの中の余白は取り除き、moovの後にまとめる
+			return nil, nil
+		case boxTypeChpl:
+			if track.Chapters != nil {
+				return nil, nil
+			}
+			return nil, w.CopyBox(file, &h.BoxInfo)
 		default:
 			return nil, w.CopyBox(file, &h.BoxInfo)
 		}
 	})
 
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return moov.data, boxes, nil
+}
+
+// ボックスを読み込み、ファイル上の位置を指す値を更新して書き込む。
+func copyShiftedBox(w io.Writer, file *os.File, box mp4.BoxInfo, shift func(uint64) uint64) error {
+	data := make([]byte, box.Size)
+	_, err := file.ReadAt(data, int64(box.Offset))
 	if err != nil {
 		return err
 	}
 
-	file.Close()
-	newFile.Close()
+	switch box.Type {
+	case mp4.BoxTypeMoof():
+		err = shiftMoof(data, box.Offset, shift)
+	case mp4.BoxTypeSidx():
+		err = shiftSidx(data, box.Offset, shift)
+	default:
+		err = shiftOffsets(data, shift)
+	}
+	if err != nil {
+		return err
+	}
 
-	os.Remove(track.FilePath)
-	os.Rename(newFilePath, track.FilePath)
+	_, err = w.Write(data)
+	return err
+}
 
-	return nil
+// 最上位のボックスの中から、moovと直後に続く余白のボックスの範囲を返す。
+// moovがなければ-1を返す。
+func findMoovRegion(boxes []mp4.BoxInfo) (int, int) {
+	first := slices.IndexFunc(boxes, func(box mp4.BoxInfo) bool {
+		return box.Type == mp4.BoxTypeMoov()
+	})
+	if first < 0 {
+		return -1, -1
+	}
+
+	last := first
+	for last+1 < len(boxes) && (boxes[last+1].Type == mp4.BoxTypeFree() || boxes[last+1].Type == mp4.BoxTypeSkip()) {
+		last++
+	}
+
+	return first, last
+}
+
+// 指定したサイズ(ヘッダーを含む)のfreeボックスを返す。サイズが0なら空を返す。
+func newFreeBox(size int64) []byte {
+	if size == 0 {
+		return nil
+	}
+
+	box := make([]byte, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], "free")
+	return box
+}
+
+// メモリ上に書き込むio.WriteSeeker
+type memoryWriter struct {
+	data []byte
+	pos  int64
+}
+
+func (m *memoryWriter) Write(p []byte) (int, error) {
+	end := m.pos + int64(len(p))
+	if end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	copy(m.data[m.pos:], p)
+	m.pos = end
+	return len(p), nil
+}
+
+func (m *memoryWriter) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += m.pos
+	case io.SeekEnd:
+		pos += int64(len(m.data))
+	}
+	if pos < 0 {
+		return 0, errors.New("不正な位置です。")
+	}
+	m.pos = pos
+	return pos, nil
 }
 
 func addStringTag(w *mp4.Writer, name string, value string) error {
@@ -197,7 +573,7 @@ func addStringTag(w *mp4.Writer, name string, value string) error {
 		return err
 	}
 
-	boxData := mp4.Data{DataType: mp4.DataTypeStringUTF8, Data: []byte(value)}
+	boxData := mp4.Data{DataType: dataTypeUTF8, Data: []byte(value)}
 
 	_, err = mp4.Marshal(w, &boxData, mp4.Context{UnderIlstMeta: true})
 	if err != nil {
@@ -212,14 +588,162 @@ func addStringTag(w *mp4.Writer, name string, value string) error {
 	return nil
 }
 
-func addBytesTag(w *mp4.Writer, name string, value []byte) error {
+// 読みは設定されていなければタグを追加しない。
+func addSortTag(w *mp4.Writer, name string, value string) error {
+	if value == "" {
+		return nil
+	}
+	return addStringTag(w, name, value)
+}
+
+// 決まった項目以外のタグを名前順に----で書き込む。
+// 名前に:があれば前をmean、後をnameにする。
+func addCustomTags(w *mp4.Writer, custom map[string][]string) error {
+	keys := maps.Keys(custom)
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		mean, name, found := strings.Cut(key, ":")
+		if !found {
+			mean, name = itunesMean, key
+		}
+
+		err := addFreeformTag(w, mean, name, custom[key]...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ----:{mean}:{name}のタグを追加する。
+// 複数の値があればdataボックスを複数追加する。
+func addFreeformTag(w *mp4.Writer, mean string, name string, values ...string) error {
+	values = slices.DeleteFunc(slices.Clone(values), func(v string) bool { return v == "" })
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := w.StartBox(&mp4.BoxInfo{Type: mp4.StrToBoxType("----")})
+	if err != nil {
+		return err
+	}
+
+	err = addFreeformNameBox(w, "mean", mean)
+	if err != nil {
+		return err
+	}
+
+	err = addFreeformNameBox(w, "name", name)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		_, err = w.StartBox(&mp4.BoxInfo{Type: mp4.BoxTypeData()})
+		if err != nil {
+			return err
+		}
+
+		boxData := mp4.Data{DataType: dataTypeUTF8, Data: []byte(value)}
+
+		_, err = mp4.Marshal(w, &boxData, mp4.Context{UnderIlstMeta: true})
+		if err != nil {
+			return err
+		}
+
+		_, err = w.EndBox()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.EndBox()
+	return err
+}
+
+// meanとnameはバージョンとフラグの4バイトの後に文字列が続く。
+func addFreeformNameBox(w *mp4.Writer, boxType string, value string) error {
+	_, err := w.StartBox(&mp4.BoxInfo{Type: mp4.StrToBoxType(boxType)})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append([]byte{0, 0, 0, 0}, value...))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.EndBox()
+	return err
+}
+
+// 既存のcovrのdataボックスを返す。
+func readCovers(file *os.File) ([]*mp4.Data, error) {
+	boxes, err := mp4.ExtractBoxesWithPayload(file, nil, []mp4.BoxPath{
+		{mp4.BoxTypeMoov(), mp4.BoxTypeUdta(), mp4.BoxTypeMeta(), mp4.BoxTypeIlst(), mp4.StrToBoxType("covr"), mp4.BoxTypeData()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	covers := []*mp4.Data{}
+	for _, box := range boxes {
+		if data, ok := box.Payload.(*mp4.Data); ok {
+			covers = append(covers, data)
+		}
+	}
+	return covers, nil
+}
+
+// アートワークを画像の形式に合った型でcovrの最初のdataボックスに書き込む。
+// 既存のcovrに複数のアートワークがあれば、2つ目以降はそのまま残す。
+// アートワークがなければcovrを書き込まない。
+func addCoverTag(w *mp4.Writer, image *model.Image, covers []*mp4.Data) error {
+	if image == nil {
+		return nil
+	}
+
+	_, err := w.StartBox(&mp4.BoxInfo{Type: mp4.StrToBoxType("covr")})
+	if err != nil {
+		return err
+	}
+
+	datas := []*mp4.Data{{DataType: imageDataType(image.MimeType, image.Data), Data: image.Data}}
+	if len(covers) > 1 {
+		datas = append(datas, covers[1:]...)
+	}
+
+	for _, data := range datas {
+		_, err = w.StartBox(&mp4.BoxInfo{Type: mp4.BoxTypeData()})
+		if err != nil {
+			return err
+		}
+
+		_, err = mp4.Marshal(w, data, mp4.Context{UnderIlstMeta: true})
+		if err != nil {
+			return err
+		}
+
+		_, err = w.EndBox()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.EndBox()
+	return err
+}
+
+func addNumberAndTotalTag(w *mp4.Writer, name string, number int, total int) error {
 
 	err := startTagBox(w, name)
 	if err != nil {
 		return err
 	}
 
-	boxData := mp4.Data{DataType: mp4.DataTypeBinary, Data: value}
+	boxData := mp4.Data{DataType: dataTypeImplicit, Data: formatNumberAndTotal(name, number, total)}
 
 	_, err = mp4.Marshal(w, &boxData, mp4.Context{UnderIlstMeta: true})
 	if err != nil {
@@ -234,18 +758,15 @@ func addBytesTag(w *mp4.Writer, name string, value []byte) error {
 	return nil
 }
 
-func addNumberAndTotalTag(w *mp4.Writer, name string, number int, total int) error {
+// 1バイトの整数のタグを追加する。
+func addIntegerTag(w *mp4.Writer, name string, value int8) error {
 
 	err := startTagBox(w, name)
 	if err != nil {
 		return err
 	}
 
-	data := make([]byte, 8)
-	binary.BigEndian.PutUint16(data[2:4], uint16(number))
-	binary.BigEndian.PutUint16(data[4:6], uint16(total))
-
-	boxData := mp4.Data{DataType: mp4.DataTypeBinary, Data: data}
+	boxData := mp4.Data{DataType: dataTypeInteger, Data: []byte{byte(value)}}
 
 	_, err = mp4.Marshal(w, &boxData, mp4.Context{UnderIlstMeta: true})
 	if err != nil {
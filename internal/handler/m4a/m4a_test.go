@@ -0,0 +1,153 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// テスト用のファイルのmoovにilstを追加する。
+func addIlst(t *testing.T, filePath string, items []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, boxes := splitTopLevelBoxes(t, data)
+	moovBox := boxes[len(boxes)-1]
+	prefix := data[:len(data)-len(moovBox)]
+	_, moovPayload, _, _ := splitBox(moovBox)
+
+	hdlr := make([]byte, 25)
+	copy(hdlr[8:], "mdir")
+	meta := append(fullBoxHeader(0)[:4], newBox("hdlr", hdlr)...)
+	meta = append(meta, newBox("ilst", items)...)
+	udta := newBox("udta", newBox("meta", meta))
+
+	data = append(prefix, newBox("moov", append(append([]byte{}, moovPayload...), udta...))...)
+	err = os.WriteFile(filePath, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ----の項目を作成する。meanとnameのペイロードはそのまま使う。
+func newFreeformItem(mean []byte, name []byte, value string) []byte {
+	data := binary.BigEndian.AppendUint32(nil, 1)
+	data = append(data, 0, 0, 0, 0)
+	data = append(data, value...)
+
+	item := newBox("mean", mean)
+	item = append(item, newBox("name", name)...)
+	item = append(item, newBox("data", data)...)
+	return newBox("----", item)
+}
+
+func TestReadFreeformTag(t *testing.T) {
+	tests := []struct {
+		name string
+		mean []byte
+		key  []byte
+		want map[string][]string
+	}{
+		{
+			name: "meanとnameがタグの名前になる",
+			mean: append([]byte{0, 0, 0, 0}, "org.example"...),
+			key:  append([]byte{0, 0, 0, 0}, "MOOD"...),
+			want: map[string][]string{"org.example:MOOD": {"happy"}},
+		},
+		{
+			name: "iTunesのmeanならnameだけがタグの名前になる",
+			mean: append([]byte{0, 0, 0, 0}, itunesMean...),
+			key:  append([]byte{0, 0, 0, 0}, "MOOD"...),
+			want: map[string][]string{"MOOD": {"happy"}},
+		},
+		{
+			name: "バージョンとフラグが足りないmeanは空として扱う",
+			mean: []byte{0, 0},
+			key:  append([]byte{0, 0, 0, 0}, "MOOD"...),
+			want: map[string][]string{":MOOD": {"happy"}},
+		},
+		{
+			name: "バージョンとフラグが足りないnameは空として扱う",
+			mean: append([]byte{0, 0, 0, 0}, itunesMean...),
+			key:  []byte{},
+			want: map[string][]string{"": {"happy"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := copyTestFile(t)
+			addIlst(t, filePath, newFreeformItem(tt.mean, tt.key, "happy"))
+
+			track, err := (&M4aHandler{}).ReadTrack(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(track.Custom, tt.want) {
+				t.Errorf("Custom = %v, want %v", track.Custom, tt.want)
+			}
+		})
+	}
+}
+
+// gnreの項目を作成する。numberはID3v1のジャンル番号に1を足した値。
+func newGenreItem(number uint16) []byte {
+	data := make([]byte, 8)
+	data = binary.BigEndian.AppendUint16(data, number)
+	return newBox("gnre", newBox("data", data))
+}
+
+func TestGenres(t *testing.T) {
+	filePath := copyTestFile(t)
+	h := &M4aHandler{}
+
+	track := &model.Track{FilePath: filePath, Title: "title", Genres: []string{"Hip-Hop/Rap", "Pop"}}
+	err := h.WriteTrack(track, config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := h.ReadTrack(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Genres, track.Genres) {
+		t.Errorf("Genres = %q, want %q", read.Genres, track.Genres)
+	}
+}
+
+func TestReadStandardGenre(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []byte
+		want  []string
+	}{
+		{"gnreのジャンル番号", newGenreItem(18), []string{"Rock"}},
+		{"©genがあればgnreは使わない", append(newGenreItem(18), newBox("\251gen", newBox("data", append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, "J-Pop"...)))...), []string{"J-Pop"}},
+		{"不明なジャンル番号", newGenreItem(1000), nil},
+		{"他の項目の後のgnre", append(newBox("\251nam", newBox("data", append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, "title"...))), newGenreItem(14)...), []string{"Pop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := copyTestFile(t)
+			addIlst(t, filePath, tt.items)
+
+			track, err := (&M4aHandler{}).ReadTrack(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(track.Genres, tt.want) {
+				t.Errorf("Genres = %q, want %q", track.Genres, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errInvalidBox = errors.New("M4Aファイルの形式が不正です。")
+
+// ファイルの書き直しでボックスの位置が変わった時に、ボックスの並びの中のファイル上の位置を指す値を更新する。
+// stco、co64、saio(moovの中)とtfra(mfraの中)が対象で、moovとmfraの中は子のボックスもたどる。
+// moofとsidxの中の位置は基準がボックスごとに異なるので、shiftMoofとshiftSidxで更新する。
+// shiftは元のファイル上の位置を新しいファイル上の位置に変換する。
+func shiftOffsets(data []byte, shift func(uint64) uint64) error {
+	for len(data) > 0 {
+		boxType, payload, size, err := splitBox(data)
+		if err != nil {
+			return err
+		}
+
+		switch boxType {
+		case "moov", "trak", "mdia", "minf", "stbl", "mfra":
+			err = shiftOffsets(payload, shift)
+		case "stco":
+			err = shiftChunkOffsets(payload, 4, shift)
+		case "co64":
+			err = shiftChunkOffsets(payload, 8, shift)
+		case "saio":
+			// moovの中ではファイル上の位置
+			err = shiftAuxInfoOffsets(payload, 0, shift)
+		case "tfra":
+			err = shiftMoofOffsets(payload, shift)
+		}
+		if err != nil {
+			return err
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// 先頭のボックスの種類、ペイロード、ボックス全体のサイズを返す。
+func splitBox(data []byte) (string, []byte, int, error) {
+	if len(data) < 8 {
+		return "", nil, 0, errInvalidBox
+	}
+
+	size := uint64(binary.BigEndian.Uint32(data))
+	headerSize := uint64(8)
+	switch size {
+	case 0:
+		// ファイルの終わりまで
+		size = uint64(len(data))
+	case 1:
+		if len(data) < 16 {
+			return "", nil, 0, errInvalidBox
+		}
+		size = binary.BigEndian.Uint64(data[8:])
+		headerSize = 16
+	}
+	if size < headerSize || size > uint64(len(data)) {
+		return "", nil, 0, errInvalidBox
+	}
+
+	return string(data[4:8]), data[headerSize:size], int(size), nil
+}
+
+// stcoまたはco64のチャンクの位置を更新する。
+func shiftChunkOffsets(payload []byte, entrySize int, shift func(uint64) uint64) error {
+	// バージョンとフラグの4バイトの後にエントリー数
+	if len(payload) < 8 {
+		return errInvalidBox
+	}
+	entryCount := int(binary.BigEndian.Uint32(payload[4:]))
+	entries := payload[8:]
+	if entryCount > len(entries)/entrySize {
+		return errInvalidBox
+	}
+
+	for i := 0; i < entryCount; i++ {
+		entry := entries[i*entrySize:]
+		if entrySize == 4 {
+			offset := shift(uint64(binary.BigEndian.Uint32(entry)))
+			if offset > math.MaxUint32 {
+				return errors.New("チャンクの位置が4GiBを超えるため書き込めません。")
+			}
+			binary.BigEndian.PutUint32(entry, uint32(offset))
+		} else {
+			binary.BigEndian.PutUint64(entry, shift(binary.BigEndian.Uint64(entry)))
+		}
+	}
+
+	return nil
+}
+
+// moofの各trafのtfhdとsaioの位置を更新する。offsetはmoofの元のファイル上の位置。
+func shiftMoof(data []byte, offset uint64, shift func(uint64) uint64) error {
+	_, payload, _, err := splitBox(data)
+	if err != nil {
+		return err
+	}
+
+	first := true
+	for len(payload) > 0 {
+		boxType, traf, size, err := splitBox(payload)
+		if err != nil {
+			return err
+		}
+
+		if boxType == "traf" {
+			err = shiftTraf(traf, offset, first, shift)
+			if err != nil {
+				return err
+			}
+			first = false
+		}
+
+		payload = payload[size:]
+	}
+
+	return nil
+}
+
+// tfhdのフラグ
+const (
+	tfhdBaseDataOffsetPresent = 0x000001
+	tfhdDefaultBaseIsMoof     = 0x020000
+)
+
+// trafのtfhdのbase_data_offsetとsaioの位置を更新する。
+// saioの位置はtrafのサンプルと同じ基準からの相対位置で、基準はbase_data_offsetがあればその位置、
+// なければmoofの先頭(default-base-is-moofの場合と最初のtrafの場合)か前のtrafのデータの終わりになる。
+// 前のtrafのデータの終わりを基準にするsaioは更新できないのでエラーにする。
+func shiftTraf(data []byte, moofOffset uint64, first bool, shift func(uint64) uint64) error {
+	var base uint64
+	hasBase := false
+
+	for len(data) > 0 {
+		boxType, payload, size, err := splitBox(data)
+		if err != nil {
+			return err
+		}
+
+		switch boxType {
+		case "tfhd":
+			if len(payload) < 8 {
+				return errInvalidBox
+			}
+			flags := binary.BigEndian.Uint32(payload) & 0xffffff
+			switch {
+			case flags&tfhdBaseDataOffsetPresent != 0:
+				if len(payload) < 16 {
+					return errInvalidBox
+				}
+				base = binary.BigEndian.Uint64(payload[8:])
+				hasBase = true
+				binary.BigEndian.PutUint64(payload[8:], shift(base))
+			case flags&tfhdDefaultBaseIsMoof != 0 || first:
+				base = moofOffset
+				hasBase = true
+			}
+		case "saio":
+			if !hasBase {
+				return errors.New("saioの位置の基準が分からないため、ファイルを書き直せません。")
+			}
+			err = shiftAuxInfoOffsets(payload, base, shift)
+		}
+		if err != nil {
+			return err
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// saioの補助情報の位置を更新する。位置はbaseからの相対位置で、moovの中ではbaseは0になる。
+func shiftAuxInfoOffsets(payload []byte, base uint64, shift func(uint64) uint64) error {
+	if len(payload) < 4 {
+		return errInvalidBox
+	}
+	version := payload[0]
+	flags := binary.BigEndian.Uint32(payload) & 0xffffff
+	rest := payload[4:]
+
+	// aux_info_typeとaux_info_type_parameter
+	if flags&0x000001 != 0 {
+		if len(rest) < 8 {
+			return errInvalidBox
+		}
+		rest = rest[8:]
+	}
+
+	if len(rest) < 4 {
+		return errInvalidBox
+	}
+	entryCount := int(binary.BigEndian.Uint32(rest))
+	entries := rest[4:]
+	entrySize := 4
+	if version != 0 {
+		entrySize = 8
+	}
+	if entryCount > len(entries)/entrySize {
+		return errInvalidBox
+	}
+
+	for i := 0; i < entryCount; i++ {
+		entry := entries[i*entrySize:]
+		if entrySize == 4 {
+			offset := shift(base+uint64(binary.BigEndian.Uint32(entry))) - shift(base)
+			if offset > math.MaxUint32 {
+				return errInvalidBox
+			}
+			binary.BigEndian.PutUint32(entry, uint32(offset))
+		} else {
+			binary.BigEndian.PutUint64(entry, shift(base+binary.BigEndian.Uint64(entry))-shift(base))
+		}
+	}
+
+	return nil
+}
+
+// tfraの各エントリーのmoofの位置を更新する。
+func shiftMoofOffsets(payload []byte, shift func(uint64) uint64) error {
+	// バージョンとフラグ、track_IDの後に各番号の長さ、エントリー数
+	if len(payload) < 16 {
+		return errInvalidBox
+	}
+	version := payload[0]
+	lengths := binary.BigEndian.Uint32(payload[8:])
+	entryCount := int(binary.BigEndian.Uint32(payload[12:]))
+	entries := payload[16:]
+
+	// timeとmoof_offsetの後にtraf_number、trun_number、sample_number
+	timeSize := 4
+	if version != 0 {
+		timeSize = 8
+	}
+	numberSize := int(lengths>>4&3+1) + int(lengths>>2&3+1) + int(lengths&3+1)
+	entrySize := timeSize*2 + numberSize
+	if entryCount > len(entries)/entrySize {
+		return errInvalidBox
+	}
+
+	for i := 0; i < entryCount; i++ {
+		entry := entries[i*entrySize+timeSize:]
+		if timeSize == 4 {
+			offset := shift(uint64(binary.BigEndian.Uint32(entry)))
+			if offset > math.MaxUint32 {
+				return errors.New("moofの位置が4GiBを超えるため書き込めません。")
+			}
+			binary.BigEndian.PutUint32(entry, uint32(offset))
+		} else {
+			binary.BigEndian.PutUint64(entry, shift(binary.BigEndian.Uint64(entry)))
+		}
+	}
+
+	return nil
+}
+
+// sidxのfirst_offsetを更新する。
+// first_offsetはsidxの終わりからの相対位置なので、sidxと参照先の間でボックスの位置がずれた時だけ変わる。
+// offsetはsidxの元のファイル上の位置。
+func shiftSidx(data []byte, offset uint64, shift func(uint64) uint64) error {
+	_, payload, size, err := splitBox(data)
+	if err != nil {
+		return err
+	}
+
+	// バージョンとフラグ、reference_ID、timescaleの後にearliest_presentation_timeとfirst_offset
+	if len(payload) < 12 {
+		return errInvalidBox
+	}
+	anchor := offset + uint64(size)
+	if payload[0] == 0 {
+		if len(payload) < 20 {
+			return errInvalidBox
+		}
+		firstOffset := shift(anchor+uint64(binary.BigEndian.Uint32(payload[16:]))) - shift(anchor)
+		if firstOffset > math.MaxUint32 {
+			return errInvalidBox
+		}
+		binary.BigEndian.PutUint32(payload[16:], uint32(firstOffset))
+	} else {
+		if len(payload) < 28 {
+			return errInvalidBox
+		}
+		firstOffset := shift(anchor+binary.BigEndian.Uint64(payload[20:])) - shift(anchor)
+		binary.BigEndian.PutUint64(payload[20:], firstOffset)
+	}
+
+	return nil
+}
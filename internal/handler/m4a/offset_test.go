@@ -0,0 +1,326 @@
+package m4a
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// 1000以降の位置を100ずらす
+func testShift(offset uint64) uint64 {
+	if offset >= 1000 {
+		return offset + 100
+	}
+	return offset
+}
+
+func u32s(values ...uint32) []byte {
+	data := []byte{}
+	for _, value := range values {
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+	return data
+}
+
+func u64s(values ...uint64) []byte {
+	data := []byte{}
+	for _, value := range values {
+		data = binary.BigEndian.AppendUint64(data, value)
+	}
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// バージョンとフラグ
+func versionAndFlags(version byte, flags uint32) []byte {
+	return u32s(uint32(version)<<24 | flags)
+}
+
+func TestShiftOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "stco",
+			data: newBox("stco", concat(fullBoxHeader(3), u32s(500, 1000, 2000))),
+			want: newBox("stco", concat(fullBoxHeader(3), u32s(500, 1100, 2100))),
+		},
+		{
+			name: "co64",
+			data: newBox("co64", concat(fullBoxHeader(2), u64s(999, 1<<33))),
+			want: newBox("co64", concat(fullBoxHeader(2), u64s(999, 1<<33+100))),
+		},
+		{
+			name:    "stcoの位置が4GiBを超える",
+			data:    newBox("stco", concat(fullBoxHeader(1), u32s(math.MaxUint32))),
+			wantErr: true,
+		},
+		{
+			name:    "stcoのエントリーが足りない",
+			data:    newBox("stco", concat(fullBoxHeader(2), u32s(1000))),
+			wantErr: true,
+		},
+		{
+			name: "moovの中のstco",
+			data: newBox("moov", newBox("trak", newBox("mdia", newBox("minf", newBox("stbl",
+				newBox("stco", concat(fullBoxHeader(1), u32s(1500)))))))),
+			want: newBox("moov", newBox("trak", newBox("mdia", newBox("minf", newBox("stbl",
+				newBox("stco", concat(fullBoxHeader(1), u32s(1600)))))))),
+		},
+		{
+			name: "moovの中のsaio",
+			data: newBox("saio", concat(versionAndFlags(0, 0), u32s(1, 1500))),
+			want: newBox("saio", concat(versionAndFlags(0, 0), u32s(1, 1600))),
+		},
+		{
+			name: "aux_info_typeのあるsaio",
+			data: newBox("saio", concat(versionAndFlags(1, 1), []byte("cenc"), u32s(0, 2), u64s(999, 1000))),
+			want: newBox("saio", concat(versionAndFlags(1, 1), []byte("cenc"), u32s(0, 2), u64s(999, 1100))),
+		},
+		{
+			name: "tfra",
+			data: newBox("mfra", newBox("tfra", concat(versionAndFlags(1, 0), u32s(1, 0, 2),
+				u64s(0, 900), []byte{1, 1, 1}, u64s(1024, 1900), []byte{1, 1, 1}))),
+			want: newBox("mfra", newBox("tfra", concat(versionAndFlags(1, 0), u32s(1, 0, 2),
+				u64s(0, 900), []byte{1, 1, 1}, u64s(1024, 2000), []byte{1, 1, 1}))),
+		},
+		{
+			name: "番号の長さが4バイトのtfra",
+			data: newBox("tfra", concat(versionAndFlags(0, 0), u32s(1, 0x3f, 1), u32s(0, 1000, 1, 1, 1))),
+			want: newBox("tfra", concat(versionAndFlags(0, 0), u32s(1, 0x3f, 1), u32s(0, 1100, 1, 1, 1))),
+		},
+		{
+			name:    "tfraのエントリーが足りない",
+			data:    newBox("tfra", concat(versionAndFlags(0, 0), u32s(1, 0, 1), u32s(0, 1000))),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Clone(tt.data)
+			err := shiftOffsets(data, testShift)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("エラーにならない")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("got  %x\nwant %x", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftMoof(t *testing.T) {
+	// trafを1つ持つmoof
+	newTraf := func(tfhdFlags uint32, baseDataOffset uint64, saioOffset uint32) []byte {
+		tfhd := concat(versionAndFlags(0, tfhdFlags), u32s(1))
+		if tfhdFlags&tfhdBaseDataOffsetPresent != 0 {
+			tfhd = concat(tfhd, u64s(baseDataOffset))
+		}
+		saio := concat(versionAndFlags(0, 0), u32s(1, saioOffset))
+		return newBox("traf", concat(newBox("tfhd", tfhd), newBox("saio", saio)))
+	}
+	mfhd := newBox("mfhd", u32s(0, 1))
+
+	tests := []struct {
+		name    string
+		offset  uint64
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:   "base_data_offsetとsaioが同じだけずれる",
+			offset: 1500,
+			data:   newBox("moof", concat(mfhd, newTraf(tfhdBaseDataOffsetPresent, 2000, 50))),
+			want:   newBox("moof", concat(mfhd, newTraf(tfhdBaseDataOffsetPresent, 2100, 50))),
+		},
+		{
+			name:   "base_data_offsetとsaioの指す位置の間でずれる",
+			offset: 1500,
+			data:   newBox("moof", concat(mfhd, newTraf(tfhdBaseDataOffsetPresent, 900, 200))),
+			want:   newBox("moof", concat(mfhd, newTraf(tfhdBaseDataOffsetPresent, 900, 300))),
+		},
+		{
+			name:   "default-base-is-moof",
+			offset: 900,
+			data:   newBox("moof", concat(mfhd, newTraf(tfhdDefaultBaseIsMoof, 0, 200), newTraf(tfhdDefaultBaseIsMoof, 0, 50))),
+			want:   newBox("moof", concat(mfhd, newTraf(tfhdDefaultBaseIsMoof, 0, 300), newTraf(tfhdDefaultBaseIsMoof, 0, 50))),
+		},
+		{
+			name:   "最初のtrafはmoofが基準",
+			offset: 900,
+			data:   newBox("moof", concat(mfhd, newTraf(0, 0, 200))),
+			want:   newBox("moof", concat(mfhd, newTraf(0, 0, 300))),
+		},
+		{
+			name:    "2つ目以降のtrafは前のtrafのデータが基準になるので更新できない",
+			offset:  900,
+			data:    newBox("moof", concat(mfhd, newTraf(0, 0, 200), newTraf(0, 0, 200))),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Clone(tt.data)
+			err := shiftMoof(data, tt.offset, testShift)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("エラーにならない")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("got  %x\nwant %x", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftSidx(t *testing.T) {
+	// sidxのペイロードはバージョンとフラグ、reference_ID、timescale、
+	// earliest_presentation_time、first_offset、reserved、reference_count
+	newSidx := func(version byte, firstOffset uint64) []byte {
+		payload := concat(versionAndFlags(version, 0), u32s(1, 1000))
+		if version == 0 {
+			payload = concat(payload, u32s(0, uint32(firstOffset)))
+		} else {
+			payload = concat(payload, u64s(0, firstOffset))
+		}
+		return newBox("sidx", concat(payload, u32s(0)))
+	}
+
+	tests := []struct {
+		name    string
+		version byte
+		offset  uint64
+		first   uint64
+		want    uint64
+	}{
+		{"sidxと参照先の間でずれる", 0, 800, 300, 400},
+		{"sidxと参照先が同じだけずれる", 0, 1200, 300, 300},
+		{"ずれる位置より前", 0, 100, 300, 300},
+		{"バージョン1", 1, 800, 300, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := newSidx(tt.version, tt.first)
+			err := shiftSidx(data, tt.offset, testShift)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := newSidx(tt.version, tt.want); !bytes.Equal(data, want) {
+				t.Errorf("got  %x\nwant %x", data, want)
+			}
+		})
+	}
+}
+
+// テスト用のファイルのmoovをmdatの前に移動する。
+func moveMoovToFront(t *testing.T, filePath string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types, boxes := splitTopLevelBoxes(t, data)
+	if types[len(types)-1] != "moov" {
+		t.Fatalf("moovが最後にない: %v", types)
+	}
+	moov := bytes.Clone(boxes[len(boxes)-1])
+
+	// ftypの後に入れるので、その後のボックスはmoovのサイズだけずれる
+	end := uint64(len(boxes[0]))
+	err = shiftOffsets(moov, func(offset uint64) uint64 {
+		if offset >= end {
+			return offset + uint64(len(moov))
+		}
+		return offset
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := concat(boxes[0], moov)
+	for _, box := range boxes[1 : len(boxes)-1] {
+		moved = append(moved, box...)
+	}
+	err = os.WriteFile(filePath, moved, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTrackShiftsChunks(t *testing.T) {
+	filePath := copyTestFile(t)
+	moveMoovToFront(t, filePath)
+
+	h := &M4aHandler{}
+	err := h.VerifyFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioHash, err := h.HashAudio(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"moovが大きくなる", strings.Repeat("長いタイトル", 1000)},
+		{"余白に収まる", "title"},
+		{"余白に収まらない", strings.Repeat("もっと長いタイトル", 2000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.WriteTrack(&model.Track{FilePath: filePath, Title: tt.title}, config.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = h.VerifyFile(filePath)
+			if err != nil {
+				t.Error(err)
+			}
+			if got, err := h.HashAudio(filePath); err != nil || got != audioHash {
+				t.Errorf("HashAudio = %s, %v", got, err)
+			}
+
+			track, err := h.ReadTrack(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if track.Title != tt.title {
+				t.Errorf("Title = %q", track.Title)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package m4a
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// サンプルエントリの種類ごとのコーデック名
+var codecNames map[string]string = map[string]string{
+	"mp4a": "AAC",
+	"alac": "ALAC",
+	"ac-3": "AC-3",
+	"ec-3": "E-AC-3",
+	"fLaC": "FLAC",
+	"Opus": "Opus",
+}
+
+// moov/mvhdの再生時間と、音声トラックのstsdのサンプルエントリから音声ストリームの情報を取得する。
+func getStreamInfo(r io.ReadSeeker) model.StreamInfo {
+	boxes, err := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeMvhd()})
+	if err != nil || len(boxes) == 0 {
+		return model.StreamInfo{}
+	}
+
+	mvhd, ok := boxes[0].Payload.(*mp4.Mvhd)
+	if !ok || mvhd.Timescale == 0 {
+		return model.StreamInfo{}
+	}
+
+	duration := uint64(mvhd.DurationV0)
+	if mvhd.GetVersion() == 1 {
+		duration = mvhd.DurationV1
+	}
+
+	streamInfo := model.StreamInfo{
+		Duration: time.Duration(float64(duration) / float64(mvhd.Timescale) * float64(time.Second)),
+	}
+
+	setSampleEntryInfo(r, &streamInfo)
+
+	if streamInfo.Duration > 0 {
+		mdats, err := mp4.ExtractBox(r, nil, mp4.BoxPath{mp4.BoxTypeMdat()})
+		if err == nil && len(mdats) > 0 {
+			var size uint64
+			for _, mdat := range mdats {
+				size += mdat.Size - mdat.HeaderSize
+			}
+			streamInfo.Bitrate = int(float64(size*8) / streamInfo.Duration.Seconds())
+		}
+	}
+
+	return streamInfo
+}
+
+// 最初の音声のサンプルエントリからコーデック、チャンネル数などを設定する。
+func setSampleEntryInfo(r io.ReadSeeker, streamInfo *model.StreamInfo) {
+	path := mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(), mp4.BoxTypeStbl(), mp4.BoxTypeStsd()}
+	stsds, err := mp4.ExtractBox(r, nil, path)
+	if err != nil {
+		return
+	}
+
+	for _, stsd := range stsds {
+		data := make([]byte, stsd.Size-stsd.HeaderSize)
+		if _, err := r.Seek(int64(stsd.Offset+stsd.HeaderSize), io.SeekStart); err != nil {
+			continue
+		}
+		if _, err := io.ReadFull(r, data); err != nil {
+			continue
+		}
+
+		// バージョンとフラグ、エントリ数の後に最初のエントリがある
+		if len(data) < 8+36 {
+			continue
+		}
+		entry := data[8:]
+		entryType := string(entry[4:8])
+
+		codec, ok := codecNames[entryType]
+		if !ok {
+			continue
+		}
+
+		streamInfo.Codec = codec
+		streamInfo.Channels = int(binary.BigEndian.Uint16(entry[24:26]))
+		streamInfo.SampleRate = int(binary.BigEndian.Uint32(entry[32:36]) >> 16)
+
+		switch entryType {
+		case "alac":
+			streamInfo.BitDepth = int(binary.BigEndian.Uint16(entry[26:28]))
+			// ALACSpecificConfigの値の方が正確(16ビットに収まらないサンプリング周波数など)
+			if len(entry) >= 36+36 && string(entry[40:44]) == "alac" {
+				config := entry[48:]
+				streamInfo.BitDepth = int(config[5])
+				streamInfo.Channels = int(config[9])
+				streamInfo.SampleRate = int(binary.BigEndian.Uint32(config[20:24]))
+			}
+		case "fLaC":
+			streamInfo.BitDepth = int(binary.BigEndian.Uint16(entry[26:28]))
+		}
+
+		return
+	}
+}
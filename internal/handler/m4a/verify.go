@@ -0,0 +1,212 @@
+package m4a
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abema/go-mp4"
+)
+
+// 各トラックのチャンク(stco/co64の位置とstsc、stszから求めたサイズ)が
+// mdatの中に収まっているか確認する。
+// フラグメント化されたファイルはmoofの各trunが指すデータも確認する。
+func (h *M4aHandler) VerifyFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mdats, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMdat()})
+	if err != nil {
+		return errors.New("ファイルの構造を読み込めませんでした。")
+	}
+	if len(mdats) == 0 {
+		return errors.New("mdatがありません。")
+	}
+
+	traks, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak()})
+	if err != nil || len(traks) == 0 {
+		return errors.New("トラックがありません。")
+	}
+
+	for i, trak := range traks {
+		chunks, err := readChunks(file, trak)
+		if err != nil {
+			return fmt.Errorf("トラック%d: %w", i+1, err)
+		}
+
+		for j, chunk := range chunks {
+			if !isInMdat(chunk, mdats) {
+				return fmt.Errorf("トラック%dの%d番目のチャンクがmdatの外を指しています。", i+1, j+1)
+			}
+		}
+	}
+
+	moofs, err := mp4.ExtractBox(file, nil, mp4.BoxPath{mp4.BoxTypeMoof()})
+	if err != nil {
+		return errors.New("ファイルの構造を読み込めませんでした。")
+	}
+
+	for i, moof := range moofs {
+		chunks, err := readFragmentChunks(file, moof)
+		if err != nil {
+			return fmt.Errorf("フラグメント%d: %w", i+1, err)
+		}
+
+		for _, chunk := range chunks {
+			if !isInMdat(chunk, mdats) {
+				return fmt.Errorf("フラグメント%dのデータがmdatの外を指しています。", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+type chunk struct {
+	offset uint64
+	size   uint64
+}
+
+func readChunks(file io.ReadSeeker, trak *mp4.BoxInfo) ([]chunk, error) {
+	stbl := mp4.BoxPath{mp4.BoxTypeMdia(), mp4.BoxTypeMinf(), mp4.BoxTypeStbl()}
+	boxes, err := mp4.ExtractBoxesWithPayload(file, trak, []mp4.BoxPath{
+		append(stbl, mp4.BoxTypeStco()),
+		append(stbl, mp4.BoxTypeCo64()),
+		append(stbl, mp4.BoxTypeStsc()),
+		append(stbl, mp4.BoxTypeStsz()),
+	})
+	if err != nil {
+		return nil, errors.New("サンプルテーブルを読み込めませんでした。")
+	}
+
+	// フラグメント化されたファイルではサンプルテーブルが空になる
+	var offsets []uint64
+	hasOffsets := false
+	var stsc *mp4.Stsc
+	var stsz *mp4.Stsz
+	for _, box := range boxes {
+		switch payload := box.Payload.(type) {
+		case *mp4.Stco:
+			hasOffsets = true
+			for _, offset := range payload.ChunkOffset {
+				offsets = append(offsets, uint64(offset))
+			}
+		case *mp4.Co64:
+			hasOffsets = true
+			offsets = append(offsets, payload.ChunkOffset...)
+		case *mp4.Stsc:
+			stsc = payload
+		case *mp4.Stsz:
+			stsz = payload
+		}
+	}
+
+	if !hasOffsets || stsc == nil || stsz == nil {
+		return nil, errors.New("サンプルテーブルがありません。")
+	}
+
+	chunks := make([]chunk, len(offsets))
+	sample := 0
+	for i, offset := range offsets {
+		chunks[i].offset = offset
+
+		// stscは各エントリの最初のチャンク番号(1から)以降のチャンクのサンプル数を表す
+		samplesPerChunk := 0
+		for _, entry := range stsc.Entries {
+			if int(entry.FirstChunk) <= i+1 {
+				samplesPerChunk = int(entry.SamplesPerChunk)
+			}
+		}
+
+		for j := 0; j < samplesPerChunk; j++ {
+			if stsz.SampleSize != 0 {
+				chunks[i].size += uint64(stsz.SampleSize)
+			} else if sample < len(stsz.EntrySize) {
+				chunks[i].size += uint64(stsz.EntrySize[sample])
+			} else {
+				return nil, errors.New("stszのサンプル数が足りません。")
+			}
+			sample++
+		}
+	}
+
+	if sample != int(stsz.SampleCount) {
+		return nil, errors.New("チャンクのサンプル数の合計がstszと一致しません。")
+	}
+
+	return chunks, nil
+}
+
+// moofの各trunが指すデータの位置とサイズを返す。
+func readFragmentChunks(file io.ReadSeeker, moof *mp4.BoxInfo) ([]chunk, error) {
+	boxes, err := mp4.ExtractBoxesWithPayload(file, moof, []mp4.BoxPath{
+		{mp4.BoxTypeTraf(), mp4.BoxTypeTfhd()},
+		{mp4.BoxTypeTraf(), mp4.BoxTypeTrun()},
+	})
+	if err != nil {
+		return nil, errors.New("フラグメントを読み込めませんでした。")
+	}
+
+	chunks := []chunk{}
+	var tfhd *mp4.Tfhd
+	// 同じtrafの前のtrunのデータ
+	var previous *chunk
+	for _, box := range boxes {
+		switch payload := box.Payload.(type) {
+		case *mp4.Tfhd:
+			tfhd = payload
+			previous = nil
+		case *mp4.Trun:
+			if tfhd == nil {
+				return nil, errors.New("tfhdがありません。")
+			}
+
+			// data_offsetがなければ同じtrafの前のtrunのデータに続く
+			c := &chunk{}
+			if payload.CheckFlag(trunDataOffsetPresent) || previous == nil {
+				// base_data_offsetがなければmoofの先頭が基準になる
+				base := moof.Offset
+				if tfhd.CheckFlag(mp4.TfhdBaseDataOffsetPresent) {
+					base = tfhd.BaseDataOffset
+				}
+				c.offset = uint64(int64(base) + int64(payload.DataOffset))
+			} else {
+				c.offset = previous.offset + previous.size
+			}
+
+			for _, entry := range payload.Entries {
+				if payload.CheckFlag(trunSampleSizePresent) {
+					c.size += uint64(entry.SampleSize)
+				} else if tfhd.CheckFlag(mp4.TfhdDefaultSampleSizePresent) {
+					c.size += uint64(tfhd.DefaultSampleSize)
+				}
+			}
+
+			chunks = append(chunks, *c)
+			previous = c
+		}
+	}
+
+	return chunks, nil
+}
+
+// trunのフラグ
+const (
+	trunDataOffsetPresent = 0x000001
+	trunSampleSizePresent = 0x000200
+)
+
+func isInMdat(c chunk, mdats []*mp4.BoxInfo) bool {
+	for _, mdat := range mdats {
+		start := mdat.Offset + mdat.HeaderSize
+		end := mdat.Offset + mdat.Size
+		if c.offset >= start && c.offset+c.size <= end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// CDの1秒あたりのフレーム数
+const cdFramesPerSecond = 75
+
+// 1曲目の開始位置(リードイン)
+const cdLeadInFrames = 150
+
+// xmcd形式のファイル1件分のレコード
+type xmcdRecord struct {
+	offsets    []int
+	discLength int
+	values     map[string]string
+}
+
+// freedb形式のアーカイブはジャンルごとのディレクトリにディスクIDのファイル名で保存されている。
+func searchFreedb(dbPath string, durations []time.Duration, tolerance time.Duration) ([]*Candidate, error) {
+	discID := freedbDiscID(durations)
+
+	filePaths := []string{filepath.Join(dbPath, discID)}
+	if entries, err := os.ReadDir(dbPath); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				filePaths = append(filePaths, filepath.Join(dbPath, entry.Name(), discID))
+			}
+		}
+	}
+
+	candidates := []*Candidate{}
+
+	for _, filePath := range filePaths {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+
+		// 古いエントリはISO-8859-1で書かれている
+		if !utf8.Valid(data) {
+			data, err = charmap.ISO8859_1.NewDecoder().Bytes(data)
+			if err != nil {
+				continue
+			}
+		}
+
+		for _, record := range parseXmcd(data) {
+			if candidate := matchXmcdRecord(record, durations, tolerance); candidate != nil {
+				candidate.Source = "freedb " + filepath.Base(filepath.Dir(filePath))
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// 各トラックの再生時間からfreedbのディスクIDを計算する。
+func freedbDiscID(durations []time.Duration) string {
+	checksum := 0
+	offset := cdLeadInFrames
+	for _, duration := range durations {
+		for seconds := offset / cdFramesPerSecond; seconds > 0; seconds /= 10 {
+			checksum += seconds % 10
+		}
+		offset += int(math.Round(duration.Seconds() * cdFramesPerSecond))
+	}
+
+	totalSeconds := offset/cdFramesPerSecond - cdLeadInFrames/cdFramesPerSecond
+
+	return fmt.Sprintf("%08x", (checksum%0xff)<<24|totalSeconds<<8|len(durations))
+}
+
+var xmcdOffsetPattern *regexp.Regexp = regexp.MustCompile(`^#\s*(\d+)\s*$`)
+var xmcdDiscLengthPattern *regexp.Regexp = regexp.MustCompile(`^#\s*Disc length:\s*(\d+)`)
+
+// 1つのファイルに複数のレコードが含まれていることがある。
+func parseXmcd(data []byte) []*xmcdRecord {
+	records := []*xmcdRecord{}
+	var record *xmcdRecord
+	inOffsets := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, "# xmcd") || record == nil {
+			record = &xmcdRecord{values: map[string]string{}}
+			records = append(records, record)
+			inOffsets = false
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if strings.Contains(line, "Track frame offsets") {
+				inOffsets = true
+			} else if match := xmcdOffsetPattern.FindStringSubmatch(line); inOffsets && match != nil {
+				offset, _ := strconv.Atoi(match[1])
+				record.offsets = append(record.offsets, offset)
+			} else if match := xmcdDiscLengthPattern.FindStringSubmatch(line); match != nil {
+				record.discLength, _ = strconv.Atoi(match[1])
+				inOffsets = false
+			} else {
+				inOffsets = false
+			}
+			continue
+		}
+
+		// 長い値は同じキーで複数行に分けて書かれる
+		key, value, found := strings.Cut(line, "=")
+		if found {
+			record.values[key] += unescapeXmcd(value)
+		}
+	}
+
+	return records
+}
+
+func unescapeXmcd(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`).Replace(s)
+}
+
+func matchXmcdRecord(record *xmcdRecord, durations []time.Duration, tolerance time.Duration) *Candidate {
+	if len(record.offsets) == 0 || record.discLength == 0 {
+		return nil
+	}
+
+	lengths := make([]time.Duration, len(record.offsets))
+	for i, offset := range record.offsets {
+		end := record.discLength * cdFramesPerSecond
+		if i+1 < len(record.offsets) {
+			end = record.offsets[i+1]
+		}
+		lengths[i] = time.Duration(end-offset) * time.Second / cdFramesPerSecond
+	}
+
+	difference, ok := compareDurations(durations, lengths, tolerance)
+	if !ok {
+		return nil
+	}
+
+	albumArtist, album := splitXmcdTitle(record.values["DTITLE"])
+	various := strings.HasPrefix(strings.ToLower(albumArtist), "various")
+
+	tracks := []*model.Track{}
+	for i := range record.offsets {
+		title := record.values["TTITLE"+strconv.Itoa(i)]
+		artists := []string{}
+
+		// オムニバスでは「アーティスト / タイトル」の形式で書かれている
+		if various {
+			if artist, trackTitle, found := strings.Cut(title, " / "); found {
+				title = trackTitle
+				artists = append(artists, artist)
+			}
+		}
+
+		tracks = append(tracks, &model.Track{
+			Album:       album,
+			AlbumArtist: albumArtist,
+			Date:        record.values["DYEAR"],
+			Title:       title,
+			Artists:     artists,
+		})
+	}
+
+	return &Candidate{Tracks: numberTracks([][]*model.Track{tracks}), Difference: difference}
+}
+
+// DTITLEは「アーティスト / アルバム」の形式
+func splitXmcdTitle(dtitle string) (string, string) {
+	artist, album, found := strings.Cut(dtitle, " / ")
+	if !found {
+		return dtitle, dtitle
+	}
+	return artist, album
+}
@@ -0,0 +1,99 @@
+package lookup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// 検索で見つかったアルバムの候補
+type Candidate struct {
+	Source string
+	Tracks []*model.Track
+	// 各トラックの再生時間の差の合計
+	Difference time.Duration
+}
+
+func (c *Candidate) String() string {
+	track := c.Tracks[0]
+	s := fmt.Sprintf("%s / %s", track.AlbumArtist, track.Album)
+	if track.Date != "" {
+		s += fmt.Sprintf(" (%s)", track.Date)
+	}
+	return fmt.Sprintf("%s [%s 差%.1f秒]", s, c.Source, c.Difference.Seconds())
+}
+
+// ローカルのデータベースからトラック数と再生時間が一致するアルバムを探す。
+// dbPathがディレクトリならfreedb形式のアーカイブ、ファイルならMusicBrainzのJSONダンプとみなす。
+// 再生時間の差が小さい順に返す。
+func Search(dbPath string, durations []time.Duration, tolerance time.Duration) ([]*Candidate, error) {
+	if dbPath == "" {
+		return nil, errors.New("データベースが設定されていません。")
+	}
+
+	stat, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, errors.New("データベースが見つかりません。")
+	}
+
+	var candidates []*Candidate
+	if stat.IsDir() {
+		candidates, err = searchFreedb(dbPath, durations, tolerance)
+	} else {
+		candidates, err = searchMusicBrainz(dbPath, durations, tolerance)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Difference < candidates[j].Difference
+	})
+
+	return candidates, nil
+}
+
+// 再生時間を比較し、すべて許容範囲内なら差の合計を返す。
+// 長さが不明(0)のトラックは比較しない。
+func compareDurations(durations []time.Duration, lengths []time.Duration, tolerance time.Duration) (time.Duration, bool) {
+	if len(durations) != len(lengths) {
+		return 0, false
+	}
+
+	var total time.Duration
+	for i, duration := range durations {
+		if lengths[i] == 0 {
+			continue
+		}
+
+		diff := duration - lengths[i]
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			return 0, false
+		}
+		total += diff
+	}
+
+	return total, true
+}
+
+// ディスク番号とトラック番号を設定する。
+func numberTracks(tracksByDisc [][]*model.Track) []*model.Track {
+	allTracks := []*model.Track{}
+	for i, tracks := range tracksByDisc {
+		for j, track := range tracks {
+			track.DiscNumber = i + 1
+			track.TotalDiscs = len(tracksByDisc)
+			track.TrackNumber = j + 1
+			track.TotalTracks = len(tracks)
+		}
+		allTracks = append(allTracks, tracks...)
+	}
+	return allTracks
+}
@@ -0,0 +1,168 @@
+package lookup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// MusicBrainzのJSONダンプのリリース。使う項目だけを定義する。
+type mbRelease struct {
+	ID           string           `json:"id"`
+	Title        string           `json:"title"`
+	Date         string           `json:"date"`
+	ArtistCredit []mbArtistCredit `json:"artist-credit"`
+	ReleaseGroup struct {
+		ID string `json:"id"`
+	} `json:"release-group"`
+	Media []struct {
+		Tracks []mbTrack `json:"tracks"`
+	} `json:"media"`
+}
+
+type mbArtistCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+	Artist     struct {
+		ID string `json:"id"`
+	} `json:"artist"`
+}
+
+type mbTrack struct {
+	ID           string           `json:"id"`
+	Title        string           `json:"title"`
+	Length       int64            `json:"length"`
+	ArtistCredit []mbArtistCredit `json:"artist-credit"`
+	Recording    struct {
+		ID     string `json:"id"`
+		Length int64  `json:"length"`
+	} `json:"recording"`
+}
+
+// 1行に1リリースのJSON(JSON Lines)か、リリースの配列のJSONを読み込んで検索する。
+func searchMusicBrainz(dbPath string, durations []time.Duration, tolerance time.Duration) ([]*Candidate, error) {
+	dbFile, err := os.Open(dbPath)
+	if err != nil {
+		return nil, errors.New("データベースを読み込めませんでした。")
+	}
+	defer dbFile.Close()
+
+	reader := bufio.NewReader(dbFile)
+	decoder := json.NewDecoder(reader)
+
+	isArray := false
+	if first, err := peekNonSpace(reader); err == nil && first == '[' {
+		isArray = true
+		if _, err := decoder.Token(); err != nil {
+			return nil, errors.New("データベースの形式が不正です。")
+		}
+	}
+
+	candidates := []*Candidate{}
+
+	for !isArray || decoder.More() {
+		release := mbRelease{}
+		err := decoder.Decode(&release)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("データベースの形式が不正です。")
+		}
+
+		if candidate := matchMusicBrainzRelease(&release, durations, tolerance); candidate != nil {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates, nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for i := 1; ; i++ {
+		b, err := reader.Peek(i)
+		if err != nil {
+			return 0, err
+		}
+		c := b[i-1]
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, nil
+		}
+	}
+}
+
+func matchMusicBrainzRelease(release *mbRelease, durations []time.Duration, tolerance time.Duration) *Candidate {
+	lengths := []time.Duration{}
+	for _, medium := range release.Media {
+		for _, track := range medium.Tracks {
+			length := track.Length
+			if length == 0 {
+				length = track.Recording.Length
+			}
+			lengths = append(lengths, time.Duration(length)*time.Millisecond)
+		}
+	}
+
+	difference, ok := compareDurations(durations, lengths, tolerance)
+	if !ok {
+		return nil
+	}
+
+	albumArtist, albumArtistIDs := joinArtistCredit(release.ArtistCredit)
+
+	tracksByDisc := [][]*model.Track{}
+	for _, medium := range release.Media {
+		tracks := []*model.Track{}
+		for _, mbTrack := range medium.Tracks {
+			artistCredit := mbTrack.ArtistCredit
+			if len(artistCredit) == 0 {
+				artistCredit = release.ArtistCredit
+			}
+
+			trackArtist, artistIDs := joinArtistCredit(artistCredit)
+
+			// アルバムアーティストと同じならトラックのアーティストには書かない
+			artists := []string{}
+			if trackArtist != albumArtist {
+				for _, credit := range artistCredit {
+					artists = append(artists, credit.Name)
+				}
+			}
+
+			tracks = append(tracks, &model.Track{
+				Album:                     release.Title,
+				AlbumArtist:               albumArtist,
+				Date:                      release.Date,
+				MusicBrainzAlbumID:        release.ID,
+				MusicBrainzReleaseGroupID: release.ReleaseGroup.ID,
+				MusicBrainzAlbumArtistIDs: albumArtistIDs,
+				Title:                     mbTrack.Title,
+				Artists:                   artists,
+				MusicBrainzTrackID:        mbTrack.Recording.ID,
+				MusicBrainzReleaseTrackID: mbTrack.ID,
+				MusicBrainzArtistIDs:      artistIDs,
+			})
+		}
+		tracksByDisc = append(tracksByDisc, tracks)
+	}
+
+	return &Candidate{Source: "MusicBrainz", Tracks: numberTracks(tracksByDisc), Difference: difference}
+}
+
+// クレジットの名前を区切りの語と合わせて1つの文字列にする。
+func joinArtistCredit(credits []mbArtistCredit) (string, []string) {
+	name := new(strings.Builder)
+	ids := []string{}
+	for _, credit := range credits {
+		name.WriteString(credit.Name)
+		name.WriteString(credit.JoinPhrase)
+		ids = append(ids, credit.Artist.ID)
+	}
+	return name.String(), ids
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// 録音日を返す。録音日がなければ発売日を返す。
+// 多くのプレーヤーは録音日のタグ(TDRC、DATE、©day)を日付として表示するので、そこにはこの値を書き込む。
+func (t *Track) DisplayDate() string {
+	if t.RecordingDate != "" {
+		return t.RecordingDate
+	}
+	return t.Date
+}
+
+// 録音日のタグと発売日のタグの値から録音日と発売日を設定する。
+// 発売日のタグがなければ録音日のタグの値を発売日とし、録音日が発売日と同じなら録音日は空にする。
+func (t *Track) SetDates(recordingDate string, releaseDate string) {
+	if releaseDate == "" {
+		releaseDate = recordingDate
+	}
+	if recordingDate == releaseDate {
+		recordingDate = ""
+	}
+	t.Date = releaseDate
+	t.RecordingDate = recordingDate
+}
+
+// 区切りが-、/、.の日付。月日は1桁でもよく、後に時刻があってもよい
+var datePattern = regexp.MustCompile(`^(\d{4})(?:[-/.](\d{1,2})(?:[-/.](\d{1,2}))?)?(?:[T ]\d{1,2}(?::\d{2}){0,2})?$`)
+
+// 区切りのない日付
+var compactDatePattern = regexp.MustCompile(`^(\d{4})(\d{2})(\d{2})$`)
+
+// 日付をyyyy、yyyy-mm、yyyy-mm-ddのいずれかの形式に揃える。時刻は取り除く。
+// 日付として解釈できなければ元の値とfalseを返す。空文字列は正しい日付とみなす。
+func NormalizeDate(date string) (string, bool) {
+	if date == "" {
+		return date, true
+	}
+
+	match := datePattern.FindStringSubmatch(date)
+	if match == nil {
+		match = compactDatePattern.FindStringSubmatch(date)
+	}
+	if match == nil {
+		return date, false
+	}
+
+	year, _ := strconv.Atoi(match[1])
+	if match[2] == "" {
+		return match[1], true
+	}
+
+	month, _ := strconv.Atoi(match[2])
+	if month < 1 || month > 12 {
+		return date, false
+	}
+	if match[3] == "" {
+		return fmt.Sprintf("%04d-%02d", year, month), true
+	}
+
+	// 存在しない日(2月30日など)は翌月に繰り越されるので日が変わる
+	day, _ := strconv.Atoi(match[3])
+	if time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+		return date, false
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day), true
+}
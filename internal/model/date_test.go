@@ -0,0 +1,70 @@
+package model
+
+import "testing"
+
+func TestNormalizeDate(t *testing.T) {
+	tests := []struct {
+		date   string
+		want   string
+		wantOK bool
+	}{
+		{"", "", true},
+		{"2020", "2020", true},
+		{"2020-01", "2020-01", true},
+		{"2020-01-02", "2020-01-02", true},
+		{"2020/1/2", "2020-01-02", true},
+		{"2020.12", "2020-12", true},
+		{"20200102", "2020-01-02", true},
+		{"2020-01-02T10:20:30", "2020-01-02", true},
+		{"2020-01-02 10:20", "2020-01-02", true},
+		{"2020-02-29", "2020-02-29", true},
+		{"2021-02-29", "2021-02-29", false},
+		{"2020-04-31", "2020-04-31", false},
+		{"2020-01-00", "2020-01-00", false},
+		{"2020-13", "2020-13", false},
+		{"2020-00-01", "2020-00-01", false},
+		{"202001", "202001", false},
+		{"20", "20", false},
+		{"2020年1月2日", "2020年1月2日", false},
+		{"2020-01-02Z", "2020-01-02Z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			got, ok := NormalizeDate(tt.date)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizeDate(%q) = %q, %v, want %q, %v", tt.date, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSetDates(t *testing.T) {
+	tests := []struct {
+		name              string
+		recordingDate     string
+		releaseDate       string
+		wantDate          string
+		wantRecordingDate string
+		wantDisplayDate   string
+	}{
+		{"両方ある", "2019", "2020-01-02", "2020-01-02", "2019", "2019"},
+		{"発売日のタグがない", "2020-01-02", "", "2020-01-02", "", "2020-01-02"},
+		{"同じ日付", "2020-01-02", "2020-01-02", "2020-01-02", "", "2020-01-02"},
+		{"録音日のタグがない", "", "2020", "2020", "", "2020"},
+		{"どちらもない", "", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &Track{}
+			track.SetDates(tt.recordingDate, tt.releaseDate)
+			if track.Date != tt.wantDate || track.RecordingDate != tt.wantRecordingDate {
+				t.Errorf("Date = %q, RecordingDate = %q", track.Date, track.RecordingDate)
+			}
+			if got := track.DisplayDate(); got != tt.wantDisplayDate {
+				t.Errorf("DisplayDate = %q, want %q", got, tt.wantDisplayDate)
+			}
+		})
+	}
+}
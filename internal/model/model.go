@@ -1,12 +1,31 @@
 package model
 
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
 type Track struct {
 	FilePath string
 	// アルバム情報
 	Album       string
 	AlbumArtist string
-	Date        string
-	Image       *Image
+	// 発売日
+	Date string
+	// 最初に発売された日(再発盤やリマスター盤の場合)
+	OriginalDate string
+	Image        *Image
+	// 複数のアーティストの曲を集めたアルバム(コンピレーション)
+	Compilation bool
+	// 並び替え用の読み
+	AlbumSort       string
+	AlbumArtistSort string
+	// MusicBrainzの識別子
+	MusicBrainzAlbumID        string
+	MusicBrainzReleaseGroupID string
+	MusicBrainzAlbumArtistIDs []string
 	// ディスク情報
 	DiscNumber int
 	TotalDiscs int
@@ -15,9 +34,114 @@ type Track struct {
 	TotalTracks int
 	Title       string
 	Artists     []string
+	Genres      []string
+	// 録音日。発売日と同じなら空にする
+	RecordingDate string
+	// 並び替え用の読み
+	TitleSort  string
+	ArtistSort string
+	// MusicBrainzの識別子
+	// TrackIDはレコーディング、ReleaseTrackIDはリリース中のトラックの識別子
+	MusicBrainzTrackID        string
+	MusicBrainzReleaseTrackID string
+	MusicBrainzArtistIDs      []string
+	// 1つのファイルに含まれる曲や章の区切り
+	// nilなら読み込んでいないので、書き込みでは既存の区切りを残す
+	Chapters []Chapter
+	// 音声データのSHA-256(16進数)。音声データが変化していないか確認するためにタグに記録する
+	AudioHash string
+	// 決まった項目以外のタグ。キーはタグの名前で、値は複数持てる
+	// M4Aでは----のname(com.apple.iTunes以外のmeanは「mean:name」)、
+	// FLACではVorbisコメントの名前、MP3とDSFではTXXXの説明になる
+	Custom map[string][]string
+	// 音声ストリームの情報
+	Stream StreamInfo
 }
 
 type Image struct {
 	MimeType string
 	Data     []byte
 }
+
+type Chapter struct {
+	// ファイル先頭からの開始位置
+	Start     time.Duration
+	Title     string
+	Performer string
+}
+
+// 音声ストリームの情報。ファイルから読み込んだ時だけ設定される。
+// 取得できなかった項目はゼロ値になる。
+type StreamInfo struct {
+	Duration time.Duration
+	// FLAC、MP3、AAC、ALAC、DSDなど
+	Codec string
+	// サンプリング周波数(Hz)
+	SampleRate int
+	// 量子化ビット数。非可逆圧縮では0
+	BitDepth int
+	Channels int
+	// 平均ビットレート(bps)
+	Bitrate int
+}
+
+// 決まった項目以外のタグの値を設定する。
+func (t *Track) SetCustom(name string, values ...string) {
+	if t.Custom == nil {
+		t.Custom = map[string][]string{}
+	}
+	t.Custom[name] = values
+}
+
+// 決まった項目以外のタグに値を追加する。
+func (t *Track) AddCustom(name string, value string) {
+	t.SetCustom(name, append(t.Custom[name], value)...)
+}
+
+// タグのアーティストに設定するアーティストを返す。重複は取り除く。
+// mergeAlbumArtistがtrueでコンピレーションでなければ、アルバムアーティストを先頭に加える。
+// 曲ごとのアーティストがなければ常にアルバムアーティストを使う。
+func (t *Track) TagArtists(mergeAlbumArtist bool) []string {
+	hasArtists := slices.ContainsFunc(t.Artists, func(a string) bool { return a != "" })
+
+	artists := []string{}
+	if t.AlbumArtist != "" && (mergeAlbumArtist && !t.Compilation || !hasArtists) {
+		artists = append(artists, t.AlbumArtist)
+	}
+	for _, artist := range t.Artists {
+		if artist != "" && !slices.Contains(artists, artist) {
+			artists = append(artists, artist)
+		}
+	}
+	return artists
+}
+
+// 表示用のアーティスト名を返す。複数のアーティストはseparatorでつなげる。
+func (t *Track) DisplayArtist(separator string, mergeAlbumArtist bool) string {
+	return strings.Join(t.TagArtists(mergeAlbumArtist), separator)
+}
+
+// タグの文字列項目をすべてfで変換した値に置き換える。
+// 識別子と決まった項目以外のタグは対象外。
+func (t *Track) MapStrings(f func(string) string) {
+	t.Album = f(t.Album)
+	t.AlbumArtist = f(t.AlbumArtist)
+	t.Date = f(t.Date)
+	t.OriginalDate = f(t.OriginalDate)
+	t.AlbumSort = f(t.AlbumSort)
+	t.AlbumArtistSort = f(t.AlbumArtistSort)
+	t.Title = f(t.Title)
+	for i, artist := range t.Artists {
+		t.Artists[i] = f(artist)
+	}
+	for i, genre := range t.Genres {
+		t.Genres[i] = f(genre)
+	}
+	t.RecordingDate = f(t.RecordingDate)
+	t.TitleSort = f(t.TitleSort)
+	t.ArtistSort = f(t.ArtistSort)
+	for i := range t.Chapters {
+		t.Chapters[i].Title = f(t.Chapters[i].Title)
+		t.Chapters[i].Performer = f(t.Chapters[i].Performer)
+	}
+}
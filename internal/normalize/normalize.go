@@ -0,0 +1,145 @@
+package normalize
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// タグの文字列に適用する正規化のルール。
+// ゼロ値は何も変換しない。
+type Rules struct {
+	// 波ダッシュ(〜)と全角チルダ(～)をこの文字に統一する。0なら統一しない。
+	WaveDash rune
+	// NFKCで正規化する。
+	NFKC bool
+	// 全角英数記号と全角空白を半角にする。
+	Width bool
+	// 連続する空白を1つの半角空白にする。
+	Space bool
+	// 前後の空白を取り除く。
+	Trim bool
+}
+
+// ルール名のリストからルールを作る。
+func ParseRules(names []string) (Rules, error) {
+	rules := Rules{}
+	for _, name := range names {
+		switch name {
+		case "wavedash":
+			rules.WaveDash = '〜'
+		case "tilde":
+			rules.WaveDash = '～'
+		case "nfkc":
+			rules.NFKC = true
+		case "width":
+			rules.Width = true
+		case "space":
+			rules.Space = true
+		case "trim":
+			rules.Trim = true
+		default:
+			return rules, fmt.Errorf("正規化のルールが不正です。 \"%s\"", name)
+		}
+	}
+	return rules, nil
+}
+
+func (r Rules) IsEmpty() bool {
+	return r == Rules{}
+}
+
+func (r Rules) String(s string) string {
+	if r.NFKC {
+		s = r.nfkc(s)
+	}
+
+	if r.Width {
+		s = strings.Map(func(c rune) rune {
+			switch {
+			case r.WaveDash != 0 && isWaveDash(c):
+				return c
+			case c >= '！' && c <= '～':
+				return c - ('！' - '!')
+			case c == '　':
+				return ' '
+			default:
+				return c
+			}
+		}, s)
+	}
+
+	// NFKCと半角化で全角チルダが半角になってしまわないように、統一はその後で行う。
+	if r.WaveDash != 0 {
+		s = strings.Map(func(c rune) rune {
+			if isWaveDash(c) {
+				return r.WaveDash
+			}
+			return c
+		}, s)
+	}
+
+	if r.Space {
+		s = collapseSpaces(s)
+	}
+
+	if r.Trim {
+		s = strings.TrimSpace(s)
+	}
+
+	return s
+}
+
+// NFKCで正規化する。
+// 波ダッシュを統一するときは、波ダッシュと全角チルダを変換せずに残す。
+func (r Rules) nfkc(s string) string {
+	if r.WaveDash == 0 {
+		return norm.NFKC.String(s)
+	}
+
+	normalized := new(strings.Builder)
+	for {
+		i := strings.IndexFunc(s, isWaveDash)
+		if i < 0 {
+			normalized.WriteString(norm.NFKC.String(s))
+			return normalized.String()
+		}
+		normalized.WriteString(norm.NFKC.String(s[:i]))
+		c, size := utf8.DecodeRuneInString(s[i:])
+		normalized.WriteRune(c)
+		s = s[i+size:]
+	}
+}
+
+func isWaveDash(c rune) bool {
+	return c == '〜' || c == '～'
+}
+
+// トラックのすべての文字列項目を正規化する。
+func (r Rules) Track(track *model.Track) {
+	if r.IsEmpty() {
+		return
+	}
+	track.MapStrings(r.String)
+}
+
+func collapseSpaces(s string) string {
+	collapsed := new(strings.Builder)
+	inSpace := false
+	for _, c := range s {
+		if unicode.IsSpace(c) {
+			if !inSpace {
+				collapsed.WriteRune(' ')
+			}
+			inSpace = true
+		} else {
+			collapsed.WriteRune(c)
+			inSpace = false
+		}
+	}
+	return collapsed.String()
+}
@@ -0,0 +1,97 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    Rules
+		wantErr bool
+	}{
+		{"空", nil, Rules{}, false},
+		{"すべて", []string{"wavedash", "nfkc", "width", "space", "trim"}, Rules{WaveDash: '〜', NFKC: true, Width: true, Space: true, Trim: true}, false},
+		{"後に書いた方が優先される", []string{"wavedash", "tilde"}, Rules{WaveDash: '～'}, false},
+		{"不正なルール", []string{"trim", "upper"}, Rules{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.names)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("エラーにならない")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		s     string
+		want  string
+	}{
+		{"ルールなし", nil, "　ＡＢＣ～ ", "　ＡＢＣ～ "},
+		{"wavedash", []string{"wavedash"}, "A～B〜C", "A〜B〜C"},
+		{"tilde", []string{"tilde"}, "A～B〜C", "A～B～C"},
+		{"nfkc", []string{"nfkc"}, "ＡＢＣ ｶﾞ ①", "ABC ガ 1"},
+		{"width", []string{"width"}, "ＡＢＣ！　ｶﾞ", "ABC! ｶﾞ"},
+		{"widthは統一した全角チルダを変換しない", []string{"tilde", "width"}, "Ａ〜Ｂ", "A～B"},
+		{"widthは全角チルダを半角にする", []string{"width"}, "Ａ～Ｂ", "A~B"},
+		{"nfkcとwavedash", []string{"nfkc", "wavedash"}, "Ａ～Ｂ〜Ｃ", "A〜B〜C"},
+		{"nfkcとtilde", []string{"nfkc", "tilde"}, "Ａ～Ｂ〜Ｃ", "A～B～C"},
+		{"nfkcは全角チルダを半角にする", []string{"nfkc"}, "Ａ～Ｂ", "A~B"},
+		{"wavedashとwidth", []string{"wavedash", "width"}, "Ａ～Ｂ", "A〜B"},
+		{"space", []string{"space"}, "a  \tb　c", "a b c"},
+		{"trim", []string{"trim"}, " \ta b　", "a b"},
+		{"表の順に適用する", []string{"trim", "space", "width"}, "　Ａ　　Ｂ　", "A B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rules.String(tt.s); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrack(t *testing.T) {
+	rules := Rules{Width: true, Trim: true}
+	track := &model.Track{
+		Album:    "Ａｌｂｕｍ ",
+		Title:    " Ｔｉｔｌｅ",
+		Artists:  []string{"Ａ", "Ｂ"},
+		Chapters: []model.Chapter{{Title: "Ｃ "}},
+	}
+	rules.Track(track)
+
+	if track.Album != "Album" || track.Title != "Title" {
+		t.Errorf("Album = %q, Title = %q", track.Album, track.Title)
+	}
+	if !slices.Equal(track.Artists, []string{"A", "B"}) {
+		t.Errorf("Artists = %q", track.Artists)
+	}
+	if track.Chapters[0].Title != "C" {
+		t.Errorf("Chapters[0].Title = %q", track.Chapters[0].Title)
+	}
+}
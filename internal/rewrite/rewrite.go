@@ -0,0 +1,209 @@
+package rewrite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+// ルールファイルの1行に書かれた書き換えルール。
+type Rule struct {
+	action  string
+	field   string
+	pattern *regexp.Regexp
+	arg     string
+}
+
+type Rules []*Rule
+
+var fieldNames []string = []string{
+	"album", "albumartist", "date", "albumsort", "albumartistsort",
+	"title", "artists", "titlesort", "artistsort",
+}
+
+// 複数の値を持てる項目
+var listFieldNames []string = []string{"artists"}
+
+// ルールファイルを読み込む。
+// 1行に1つ、タブ区切りで「動作 項目 正規表現 引数」を書く。
+func Load(path string) (Rules, error) {
+	rulesFile, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("ルールファイルを読み込めませんでした。")
+	}
+	defer rulesFile.Close()
+
+	scanner := bufio.NewScanner(rulesFile)
+	scanner.Split(bufio.ScanLines)
+
+	rules := Rules{}
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := parseRule(strings.Split(line, "\t"))
+		if err != nil {
+			return nil, fmt.Errorf("ルールファイルの%d行目: %w", lineNumber, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseRule(tokens []string) (*Rule, error) {
+	if len(tokens) < 3 {
+		return nil, errors.New("動作、項目、正規表現をタブ区切りで書いてください。")
+	}
+
+	rule := &Rule{action: tokens[0], field: tokens[1]}
+
+	if !slices.Contains(fieldNames, rule.field) {
+		return nil, fmt.Errorf("項目が不正です。 \"%s\"", rule.field)
+	}
+
+	pattern, err := regexp.Compile(tokens[2])
+	if err != nil {
+		return nil, fmt.Errorf("正規表現が不正です。: %s", err)
+	}
+	rule.pattern = pattern
+
+	if len(tokens) > 3 {
+		rule.arg = tokens[3]
+	}
+
+	switch rule.action {
+	case "replace":
+	case "move":
+		if !slices.Contains(fieldNames, rule.arg) {
+			return nil, fmt.Errorf("移動先の項目が不正です。 \"%s\"", rule.arg)
+		}
+	case "split":
+		if !slices.Contains(listFieldNames, rule.field) {
+			return nil, fmt.Errorf("splitは複数の値を持てる項目にしか使えません。 \"%s\"", rule.field)
+		}
+	default:
+		return nil, fmt.Errorf("動作が不正です。 \"%s\"", rule.action)
+	}
+
+	return rule, nil
+}
+
+// トラックにすべてのルールを順に適用する。
+func (rules Rules) Track(track *model.Track) {
+	for _, rule := range rules {
+		rule.apply(track)
+	}
+}
+
+func (r *Rule) apply(track *model.Track) {
+	values := getValues(track, r.field)
+
+	switch r.action {
+	case "replace":
+		for i, value := range values {
+			values[i] = r.pattern.ReplaceAllString(value, r.arg)
+		}
+
+	case "move":
+		// マッチした部分を取り除き、1つ目のグループ(なければマッチ全体)を移動先に追加する
+		moved := []string{}
+		for i, value := range values {
+			for _, match := range r.pattern.FindAllStringSubmatch(value, -1) {
+				text := match[0]
+				if len(match) > 1 {
+					text = match[1]
+				}
+				if text = strings.TrimSpace(text); text != "" {
+					moved = append(moved, text)
+				}
+			}
+			values[i] = r.pattern.ReplaceAllString(value, "")
+		}
+		setValues(track, r.field, values)
+		if len(moved) > 0 {
+			setValues(track, r.arg, append(getValues(track, r.arg), moved...))
+		}
+		return
+
+	case "split":
+		splitValues := []string{}
+		for _, value := range values {
+			for _, v := range r.pattern.Split(value, -1) {
+				if v = strings.TrimSpace(v); v != "" {
+					splitValues = append(splitValues, v)
+				}
+			}
+		}
+		values = splitValues
+	}
+
+	setValues(track, r.field, values)
+}
+
+func getValues(track *model.Track, field string) []string {
+	switch field {
+	case "album":
+		return []string{track.Album}
+	case "albumartist":
+		return []string{track.AlbumArtist}
+	case "date":
+		return []string{track.Date}
+	case "albumsort":
+		return []string{track.AlbumSort}
+	case "albumartistsort":
+		return []string{track.AlbumArtistSort}
+	case "title":
+		return []string{track.Title}
+	case "titlesort":
+		return []string{track.TitleSort}
+	case "artistsort":
+		return []string{track.ArtistSort}
+	case "artists":
+		return append([]string{}, track.Artists...)
+	default:
+		return []string{}
+	}
+}
+
+// 複数の値を持てない項目には最後の値を設定する。
+func setValues(track *model.Track, field string, values []string) {
+	last := ""
+	if len(values) > 0 {
+		last = values[len(values)-1]
+	}
+
+	switch field {
+	case "album":
+		track.Album = last
+	case "albumartist":
+		track.AlbumArtist = last
+	case "date":
+		track.Date = last
+	case "albumsort":
+		track.AlbumSort = last
+	case "albumartistsort":
+		track.AlbumArtistSort = last
+	case "title":
+		track.Title = last
+	case "titlesort":
+		track.TitleSort = last
+	case "artistsort":
+		track.ArtistSort = last
+	case "artists":
+		track.Artists = values
+	}
+}
@@ -0,0 +1,145 @@
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// ルールファイルを一時ディレクトリに書き込んで読み込む。
+func loadRules(t *testing.T, lines ...string) (Rules, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		count   int
+		wantErr string
+	}{
+		{"コメントと空行は読み飛ばす", []string{"# コメント", "", "replace\ttitle\ta\tb", "  "}, 1, ""},
+		{"引数は省略できる", []string{"replace\ttitle\t\\s+$"}, 1, ""},
+		{"列が足りない", []string{"replace\ttitle"}, 0, "1行目"},
+		{"項目が不正", []string{"# コメント", "replace\tgenre\ta\tb"}, 0, "2行目: 項目が不正です。"},
+		{"正規表現が不正", []string{"replace\ttitle\t(\tb"}, 0, "正規表現が不正です。"},
+		{"移動先が不正", []string{"move\ttitle\ta\tgenre"}, 0, "移動先の項目が不正です。"},
+		{"splitは複数の値を持つ項目だけ", []string{"split\ttitle\t&"}, 0, "splitは複数の値を持てる項目にしか使えません。"},
+		{"動作が不正", []string{"delete\ttitle\ta"}, 0, "動作が不正です。"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := loadRules(t, tt.lines...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != tt.count {
+				t.Errorf("len(rules) = %d, want %d", len(rules), tt.count)
+			}
+		})
+	}
+}
+
+func TestLoadNotFound(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "rules"))
+	if err == nil {
+		t.Error("エラーにならない")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		track model.Track
+		want  model.Track
+	}{
+		{
+			name:  "replace",
+			lines: []string{`replace	title	\s*\((?:\d{4} )?Remaster(?:ed)?(?: \d{4})?\)$`},
+			track: model.Track{Title: "Song (2011 Remastered)"},
+			want:  model.Track{Title: "Song"},
+		},
+		{
+			name:  "グループを参照して置き換える",
+			lines: []string{`replace	albumartist	^(?i:V\.?A\.?|Various)$	Various Artists`, `replace	date	^(\d{4})/(\d{2})$	$1-$2`},
+			track: model.Track{AlbumArtist: "V.A.", Date: "2020/01"},
+			want:  model.Track{AlbumArtist: "Various Artists", Date: "2020-01"},
+		},
+		{
+			name:  "replaceは各アーティストに適用する",
+			lines: []string{`replace	artists	^CV:\s*`},
+			track: model.Track{Artists: []string{"CV: A", "CV:B"}},
+			want:  model.Track{Artists: []string{"A", "B"}},
+		},
+		{
+			name:  "moveは1つ目のグループを移す",
+			lines: []string{`move	title	\s*\(feat\. ([^)]+)\)	artists`},
+			track: model.Track{Title: "Song (feat. B)", Artists: []string{"A"}},
+			want:  model.Track{Title: "Song", Artists: []string{"A", "B"}},
+		},
+		{
+			name:  "moveはグループがなければマッチ全体を移す",
+			lines: []string{`move	title	\[[^\]]+\]	album`},
+			track: model.Track{Title: "Song[Album]"},
+			want:  model.Track{Title: "Song", Album: "[Album]"},
+		},
+		{
+			name:  "マッチしなければmoveしない",
+			lines: []string{`move	title	\(feat\. ([^)]+)\)	artists`},
+			track: model.Track{Title: "Song", Artists: []string{"A"}},
+			want:  model.Track{Title: "Song", Artists: []string{"A"}},
+		},
+		{
+			name:  "split",
+			lines: []string{`split	artists	\s*&\s*`},
+			track: model.Track{Artists: []string{"A & B", "C&", "D"}},
+			want:  model.Track{Artists: []string{"A", "B", "C", "D"}},
+		},
+		{
+			name:  "書いた順に適用する",
+			lines: []string{`move	title	\s*\(feat\. ([^)]+)\)	artists`, `split	artists	\s*&\s*`},
+			track: model.Track{Title: "Song (feat. B & C)", Artists: []string{"A"}},
+			want:  model.Track{Title: "Song", Artists: []string{"A", "B", "C"}},
+		},
+		{
+			name:  "複数の値を持てない項目には最後の値を設定する",
+			lines: []string{`move	title	\((\w+)\)	album`},
+			track: model.Track{Title: "Song (X) (Y)", Album: "Album"},
+			want:  model.Track{Title: "Song  ", Album: "Y"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := loadRules(t, tt.lines...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			track := tt.track
+			rules.Track(&track)
+			if !reflect.DeepEqual(track, tt.want) {
+				t.Errorf("got %+v, want %+v", track, tt.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,32 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/feat"
 	"github.com/solidcopy/utag/internal/handler"
 	"github.com/solidcopy/utag/internal/model"
+	"github.com/solidcopy/utag/internal/rewrite"
+	"github.com/solidcopy/utag/internal/tags_file"
 
 	"golang.org/x/exp/slices"
 )
 
+// tagsファイルを作成するサブコマンドで、既存のtagsファイルを上書きしないように確認する。
+// 設定forceがtrueなら上書きする。
+func checkTagsFileOverwrite(dir string, conf *config.Config) error {
+	if conf.Force {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tags")); err == nil {
+		return errors.New("tagsファイルが既に存在します。上書きする場合は--forceを指定してください。")
+	}
+	return nil
+}
+
 var AllExtensions []string = []string{
 	".flac", ".m4a", ".mp3", ".dsf",
 }
@@ -78,3 +95,75 @@ func ReadTracks(dir string) ([]*model.Track, error) {
 
 	return tracks, nil
 }
+
+// tagsファイルを読み込んでインポート用の正規化と書き換えルールを適用する。
+func readTagsFile(dir string, conf *config.Config) ([]*model.Track, error) {
+	tracks, err := tags_file.ReadTagsFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadRewriteRules(conf.RewriteImport, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, track := range tracks {
+		conf.NormalizeImport.Track(track)
+		rules.Track(track)
+		normalizeDates(i+1, track)
+	}
+
+	return tracks, nil
+}
+
+// 日付の項目をyyyy、yyyy-mm、yyyy-mm-ddのいずれかの形式に揃える。
+// 日付として解釈できない値は警告を表示してそのまま書き込む。
+func normalizeDates(number int, track *model.Track) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"発売日", &track.Date},
+		{"オリジナルの発売日", &track.OriginalDate},
+		{"録音日", &track.RecordingDate},
+	}
+
+	for _, field := range fields {
+		date, ok := model.NormalizeDate(*field.value)
+		if !ok {
+			fmt.Printf("警告: トラック%dの%sが日付の形式ではありません。: %s\n", number, field.name, *field.value)
+		}
+		*field.value = date
+	}
+}
+
+// tagsファイルに出力する前にエクスポート用の正規化と書き換えルール、ゲストの抽出を適用する。
+func applyExportRules(tracks []*model.Track, conf *config.Config) error {
+	rules, err := loadRewriteRules(conf.RewriteExport, conf)
+	if err != nil {
+		return err
+	}
+
+	var featExtractor *feat.Extractor
+	if conf.FeatExport {
+		featExtractor = feat.NewExtractor(conf.FeatMarkers, conf.FeatSeparators)
+	}
+
+	for _, track := range tracks {
+		conf.NormalizeExport.Track(track)
+		rules.Track(track)
+		if featExtractor != nil {
+			featExtractor.Track(track)
+		}
+	}
+
+	return nil
+}
+
+func loadRewriteRules(enabled bool, conf *config.Config) (rewrite.Rules, error) {
+	if !enabled {
+		return rewrite.Rules{}, nil
+	}
+	return rewrite.Load(conf.RewriteFile)
+}
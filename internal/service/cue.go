@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/cue"
+	"github.com/solidcopy/utag/internal/model"
+	"github.com/solidcopy/utag/internal/tags_file"
+	"golang.org/x/exp/slices"
+)
+
+// ディレクトリのCUEシートからtagsファイルを作成する。
+// CUEシートが複数あればファイル名順に1枚ずつのディスクとみなす。
+func ExecuteCue(dir string, conf *config.Config) {
+	fmt.Println("CUEシートの読み込み処理を開始します。")
+
+	err := checkTagsFileOverwrite(dir, conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	tracks, err := ReadCueSheets(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = applyExportRules(tracks, conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = tags_file.WriteTagsFile(dir, tracks, false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("CUEシートの読み込み処理を完了しました。")
+}
+
+func ReadCueSheets(dir string) ([]*model.Track, error) {
+	sheets, err := readCueSheetFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := []*model.Track{}
+	for _, sheetTracks := range cueSheetTracks(sheets) {
+		tracks = append(tracks, sheetTracks...)
+	}
+
+	return tracks, nil
+}
+
+// ディレクトリのCUEシートをディスク順に読み込む。
+func readCueSheetFiles(dir string) ([]*cue.Sheet, error) {
+	cuePaths, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	if err != nil || len(cuePaths) == 0 {
+		return nil, errors.New("CUEシートが見つかりません。")
+	}
+	sort.Strings(cuePaths)
+
+	sheets := make([]*cue.Sheet, 0, len(cuePaths))
+	for _, cuePath := range cuePaths {
+		sheet, err := cue.ReadFile(cuePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(cuePath), err)
+		}
+		sheets = append(sheets, sheet)
+	}
+
+	// REM DISCNUMBERがあればその順に並べる
+	sort.SliceStable(sheets, func(i, j int) bool {
+		return sheets[i].DiscNumber < sheets[j].DiscNumber
+	})
+
+	return sheets, nil
+}
+
+// CUEシートごとのトラック情報を作成する。
+func cueSheetTracks(sheets []*cue.Sheet) [][]*model.Track {
+	tracksBySheet := [][]*model.Track{}
+	for i, sheet := range sheets {
+		discNumber := sheet.DiscNumber
+		if discNumber == 0 {
+			discNumber = i + 1
+		}
+
+		totalDiscs := sheet.TotalDiscs
+		if totalDiscs == 0 {
+			totalDiscs = len(sheets)
+		}
+
+		var genres []string
+		if sheet.Genre != "" {
+			genres = []string{sheet.Genre}
+		}
+
+		tracks := []*model.Track{}
+		for _, cueTrack := range sheet.Tracks {
+			artists := []string{}
+			if cueTrack.Performer != "" {
+				artists = append(artists, cueTrack.Performer)
+			}
+
+			tracks = append(tracks, &model.Track{
+				Album:       sheet.Title,
+				AlbumArtist: sheet.Performer,
+				Date:        sheet.Date,
+				DiscNumber:  discNumber,
+				TotalDiscs:  totalDiscs,
+				TrackNumber: cueTrack.Number,
+				TotalTracks: len(sheet.Tracks),
+				Title:       cueTrack.Title,
+				Artists:     artists,
+				Genres:      slices.Clone(genres),
+			})
+		}
+		tracksBySheet = append(tracksBySheet, tracks)
+	}
+
+	return tracksBySheet
+}
@@ -3,10 +3,13 @@ package service
 import (
 	"fmt"
 
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/model"
 	"github.com/solidcopy/utag/internal/tags_file"
+	"golang.org/x/exp/slices"
 )
 
-func ExecuteExport(dir string) {
+func ExecuteExport(dir string, conf *config.Config) {
 	fmt.Println("エクスポート処理を開始します。")
 
 	tracks, err := ReadTracks(dir)
@@ -15,9 +18,63 @@ func ExecuteExport(dir string) {
 		return
 	}
 
-	tags_file.WriteTagsFile(tracks)
+	err = applyExportRules(tracks, conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if detectCompilation(tracks, conf.ExportCompilationArtist) {
+		fmt.Printf("アルバムアーティストがなく曲ごとのアーティストが異なるので、アルバムアーティストを%sとしてコンピレーションの形式で出力します。\n", conf.ExportCompilationArtist)
+	}
+
+	tags_file.WriteTagsFile(dir, tracks, conf.ExportStreamInfo == "comment")
+
+	if conf.ExportStreamInfo == "report" {
+		err = tags_file.WriteStreamInfoFile(dir, tracks)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	for _, track := range tracks {
+		err = tags_file.WriteCueFile(track)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
 	tags_file.WriteImageFile(tracks[0])
 
 	fmt.Println("エクスポート処理を完了しました。")
 }
+
+// どのトラックにもアルバムアーティストがなく、曲ごとの先頭のアーティストが異なれば
+// コンピレーションとみなし、アルバムアーティストにartistを設定してtrueを返す。
+// 曲ごとのアーティストはそのまま残る。artistが空なら判定しない。
+func detectCompilation(tracks []*model.Track, artist string) bool {
+	if artist == "" {
+		return false
+	}
+
+	primaryArtists := []string{}
+	for _, track := range tracks {
+		if track.AlbumArtist != "" {
+			return false
+		}
+		if len(track.Artists) > 0 && track.Artists[0] != "" && !slices.Contains(primaryArtists, track.Artists[0]) {
+			primaryArtists = append(primaryArtists, track.Artists[0])
+		}
+	}
+	if len(primaryArtists) < 2 {
+		return false
+	}
+
+	for _, track := range tracks {
+		track.AlbumArtist = artist
+		track.Compilation = true
+	}
+	return true
+}
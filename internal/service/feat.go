@@ -0,0 +1,38 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/feat"
+	"github.com/solidcopy/utag/internal/tags_file"
+)
+
+// tagsファイルのタイトルからゲストのアーティストを取り出して書き直す。
+func ExecuteFeat(dir string, conf *config.Config) {
+	fmt.Println("ゲストの抽出処理を開始します。")
+
+	tracks, err := tags_file.ReadTagsFile(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if len(tracks) == 0 {
+		fmt.Println("tagsファイルにトラック情報がありません。")
+		return
+	}
+
+	featExtractor := feat.NewExtractor(conf.FeatMarkers, conf.FeatSeparators)
+	for _, track := range tracks {
+		featExtractor.Track(track)
+	}
+
+	err = tags_file.WriteTagsFile(dir, tracks, false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("ゲストの抽出処理を終了します。")
+}
@@ -3,11 +3,12 @@ package service
 import (
 	"fmt"
 
+	"github.com/solidcopy/utag/internal/config"
 	"github.com/solidcopy/utag/internal/handler"
 	"github.com/solidcopy/utag/internal/tags_file"
 )
 
-func ExecuteImport(dir string) {
+func ExecuteImport(dir string, conf *config.Config) {
 	fmt.Println("インポート処理を開始します。")
 
 	filePaths, err := FindAudioFiles(dir)
@@ -16,7 +17,7 @@ func ExecuteImport(dir string) {
 		return
 	}
 
-	tracks, err := tags_file.ReadTagsFile(dir)
+	tracks, err := readTagsFile(dir, conf)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -42,11 +43,26 @@ func ExecuteImport(dir string) {
 	for i, track := range tracks {
 		track.FilePath = filePaths[i]
 
-		err = handler.WriteTrack(track)
+		err = tags_file.ReadCueFile(track)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
+
+		if conf.ImportAudioHash {
+			track.AudioHash, err = handler.HashAudio(track.FilePath)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		// 音声データが変わらないことは、各ハンドラーが書き込む前に確認する
+		err = handler.WriteTrack(track, conf)
+		if err != nil {
+			fmt.Printf("%v: %s\n", err, track.FilePath)
+			return
+		}
 	}
 
 	fmt.Println("インポート処理を終了します。")
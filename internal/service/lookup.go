@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/lookup"
+	"github.com/solidcopy/utag/internal/tags_file"
+)
+
+// オーディオファイルの再生時間からローカルのデータベースを検索してtagsファイルを作成する。
+func ExecuteLookup(dir string, conf *config.Config) {
+	fmt.Println("検索処理を開始します。")
+
+	err := checkTagsFileOverwrite(dir, conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	tracks, err := ReadTracks(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	durations := make([]time.Duration, 0, len(tracks))
+	for _, track := range tracks {
+		if track.Stream.Duration == 0 {
+			fmt.Printf("再生時間が取得できません。: %s\n", track.FilePath)
+			return
+		}
+		durations = append(durations, track.Stream.Duration)
+	}
+
+	candidates, err := lookup.Search(conf.LookupDatabase, durations, conf.LookupTolerance)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("候補が見つかりませんでした。")
+		return
+	}
+
+	candidate, err := selectCandidate(candidates, conf.LookupIndex)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = tags_file.WriteTagsFile(dir, candidate.Tracks, false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("検索処理を完了しました。")
+}
+
+// 番号が指定されていればその候補を、候補が1つだけならそれを選ぶ。
+// どちらでもなければ一覧を表示して標準入力から番号を入力してもらう。
+func selectCandidate(candidates []*lookup.Candidate, index int) (*lookup.Candidate, error) {
+	if index > 0 {
+		if index > len(candidates) {
+			return nil, fmt.Errorf("候補は%d件しかありません。", len(candidates))
+		}
+		return candidates[index-1], nil
+	}
+
+	if len(candidates) == 1 {
+		fmt.Println(candidates[0])
+		return candidates[0], nil
+	}
+
+	for i, candidate := range candidates {
+		fmt.Printf("%d: %s\n", i+1, candidate)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("番号を入力してください: ")
+		if !scanner.Scan() {
+			return nil, errors.New("候補が選択されませんでした。")
+		}
+
+		i, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err == nil && i >= 1 && i <= len(candidates) {
+			return candidates[i-1], nil
+		}
+	}
+}
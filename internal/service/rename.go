@@ -7,11 +7,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/solidcopy/utag/internal/config"
 	"github.com/solidcopy/utag/internal/model"
 	"github.com/solidcopy/utag/internal/tags_file"
+	"github.com/solidcopy/utag/internal/translit"
 )
 
-func ExecuteRename(dir string) {
+func ExecuteRename(dir string, conf *config.Config) {
 	fmt.Println("リネーム処理を開始します。")
 
 	filePaths, err := FindAudioFiles(dir)
@@ -20,7 +22,7 @@ func ExecuteRename(dir string) {
 		return
 	}
 
-	tracks, err := tags_file.ReadTagsFile(dir)
+	tracks, err := readTagsFile(dir, conf)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -34,11 +36,19 @@ func ExecuteRename(dir string) {
 	for i, track := range tracks {
 		filePath := filePaths[i]
 
-		newBaseName := determineNewBaseName(track)
+		newBaseName := determineNewBaseName(track, conf)
 		ext := filepath.Ext(filePath)
 		newFileName := newBaseName + ext
 
-		os.Rename(filePath, filepath.Join(dir, newFileName))
+		newFilePath := filepath.Join(dir, newFileName)
+
+		err = tags_file.RenameCueFile(filePath, newFilePath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		os.Rename(filePath, newFilePath)
 	}
 
 	fmt.Println("リネーム処理を終了します。")
@@ -56,7 +66,7 @@ var charReplacingMap map[string]string = map[string]string{
 	"?":  "",
 }
 
-func determineNewBaseName(track *model.Track) string {
+func determineNewBaseName(track *model.Track, conf *config.Config) string {
 	newBaseName := new(strings.Builder)
 
 	if track.TotalDiscs > 1 {
@@ -71,13 +81,20 @@ func determineNewBaseName(track *model.Track) string {
 	format := "%0" + strconv.Itoa(length) + "d"
 	trackNumber := fmt.Sprintf(format, track.TrackNumber)
 	newBaseName.WriteString(trackNumber)
-	newBaseName.WriteRune('.')
 
 	title := track.Title
+	// ASCII文字しか表示できない機器のためにファイル名だけローマ字などに変換する
+	if conf.RenameASCII {
+		title = translit.ToASCII(title)
+	}
 	for from, to := range charReplacingMap {
 		title = strings.ReplaceAll(title, from, to)
 	}
-	newBaseName.WriteString(title)
+	// 変換で何も残らなければトラック番号だけにする
+	if title != "" {
+		newBaseName.WriteRune('.')
+		newBaseName.WriteString(title)
+	}
 
 	return newBaseName.String()
 }
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/cue"
+	"github.com/solidcopy/utag/internal/flacsplit"
+	"github.com/solidcopy/utag/internal/handler/flac"
+	"github.com/solidcopy/utag/internal/model"
+	"github.com/solidcopy/utag/internal/tags_file"
+	"golang.org/x/exp/slices"
+)
+
+// 分割元のファイルに付ける拡張子
+const splitSourceExt = ".orig"
+
+// CUEシートに従ってアルバム1枚分のFLACファイルをトラックごとのファイルに分割する。
+// 分割後はCUEシートからtagsファイルを作成し、インポートとリネームを実行する。
+// 分割元のファイルは拡張子に.origを付けて残す。
+func ExecuteSplit(dir string, conf *config.Config) {
+	fmt.Println("分割処理を開始します。")
+
+	sheets, err := readCueSheetFiles(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = validateCueIndexes(sheets)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	tracksBySheet := cueSheetTracks(sheets)
+
+	sourcePaths, err := findCueSourceFiles(dir, sheets)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// 途中で失敗したら、再実行できるように分割したファイルを削除する
+	splitPaths := []string{}
+	for i, sheet := range sheets {
+		paths, err := splitCueSheet(dir, sheet, tracksBySheet[i], sourcePaths)
+		splitPaths = append(splitPaths, paths...)
+		if err != nil {
+			removeFiles(splitPaths)
+			fmt.Println(err)
+			return
+		}
+	}
+
+	err = exportSourceImage(dir, sourcePaths[0])
+	if err != nil {
+		removeFiles(splitPaths)
+		fmt.Println(err)
+		return
+	}
+
+	for _, sourcePath := range sourcePaths {
+		err = os.Rename(sourcePath, sourcePath+splitSourceExt)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	tracks := []*model.Track{}
+	for _, sheetTracks := range tracksBySheet {
+		tracks = append(tracks, sheetTracks...)
+	}
+
+	err = applyExportRules(tracks, conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = tags_file.WriteTagsFile(dir, tracks, false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("分割処理を完了しました。")
+
+	ExecuteImport(dir, conf)
+	ExecuteRename(dir, conf)
+}
+
+// 1枚分のCUEシートに書かれたファイルを分割し、分割したファイルのパスを返す。
+// エラーになった場合も、それまでに分割したファイルのパスを返す。
+// sourcePathsはすべてのCUEシートの分割元のファイルパスで、分割したファイルの名前と重ならないようにする。
+func splitCueSheet(dir string, sheet *cue.Sheet, tracks []*model.Track, sourcePaths []string) ([]string, error) {
+	splitPaths := []string{}
+
+	var source *flacsplit.File
+	defer func() {
+		if source != nil {
+			source.Close()
+		}
+	}()
+
+	for i, cueTrack := range sheet.Tracks {
+		start := cueTrack.Indexes[1]
+
+		isFirst := i == 0 || sheet.Tracks[i-1].File != cueTrack.File
+		isLast := i == len(sheet.Tracks)-1 || sheet.Tracks[i+1].File != cueTrack.File
+
+		if isFirst {
+			sourcePath, err := findCueSourceFile(dir, cueTrack.File)
+			if err != nil {
+				return splitPaths, err
+			}
+
+			if source != nil {
+				source.Close()
+			}
+			source, err = flacsplit.Open(sourcePath)
+			if err != nil {
+				return splitPaths, fmt.Errorf("%s: %w", filepath.Base(sourcePath), err)
+			}
+
+			// 1曲目より前の音声(HTOA)は1曲目に含める
+			start = 0
+		}
+
+		sampleRate := int64(source.SampleRate())
+
+		end := source.TotalSamples()
+		if !isLast {
+			// 次のトラックのプリギャップ(INDEX 00)はこのトラックに含める
+			end = int64(sheet.Tracks[i+1].Indexes[1]) * sampleRate / cue.FramesPerSecond
+		}
+
+		filePath := filepath.Join(dir, splitFileName(tracks[i], sourcePaths))
+		if _, err := os.Stat(filePath); err == nil {
+			return splitPaths, fmt.Errorf("ファイルが既に存在します。: %s", filepath.Base(filePath))
+		}
+
+		err := source.WriteRange(filePath, int64(start)*sampleRate/cue.FramesPerSecond, end)
+		if err != nil {
+			return splitPaths, fmt.Errorf("トラック%d: %w", cueTrack.Number, err)
+		}
+		splitPaths = append(splitPaths, filePath)
+	}
+
+	return splitPaths, nil
+}
+
+// 分割する前に、すべてのトラックにINDEX 01があり、同じファイルの中で順に後になっていることを確認する。
+func validateCueIndexes(sheets []*cue.Sheet) error {
+	for _, sheet := range sheets {
+		for i, cueTrack := range sheet.Tracks {
+			index, ok := cueTrack.Indexes[1]
+			if !ok {
+				return fmt.Errorf("トラック%dのINDEX 01がありません。", cueTrack.Number)
+			}
+
+			if i > 0 {
+				prev := sheet.Tracks[i-1]
+				if prev.File == cueTrack.File && index <= prev.Indexes[1] {
+					return fmt.Errorf("トラック%dのINDEX 01が前のトラックより後になっていません。", cueTrack.Number)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CUEシートのFILEに書かれたファイルを順に探し、重複を除いたファイルパスを返す。
+func findCueSourceFiles(dir string, sheets []*cue.Sheet) ([]string, error) {
+	sourcePaths := []string{}
+	for _, sheet := range sheets {
+		for _, cueTrack := range sheet.Tracks {
+			sourcePath, err := findCueSourceFile(dir, cueTrack.File)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(sourcePaths, sourcePath) {
+				sourcePaths = append(sourcePaths, sourcePath)
+			}
+		}
+	}
+	return sourcePaths, nil
+}
+
+func removeFiles(filePaths []string) {
+	for _, filePath := range filePaths {
+		os.Remove(filePath)
+	}
+}
+
+// CUEシートのFILEに書かれたファイルを探す。
+// WAVEなど別の形式のファイル名が書かれていることが多いので、同じ名前のFLACファイルも探す。
+func findCueSourceFile(dir string, fileName string) (string, error) {
+	filePath := filepath.Join(dir, fileName)
+	flacPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".flac"
+
+	for _, path := range []string{filePath, flacPath} {
+		if _, err := os.Stat(path); err == nil && filepath.Ext(path) == ".flac" {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("分割するFLACファイルが見つかりません。: %s", fileName)
+}
+
+// リネームされるまでの仮のファイル名。
+// 複数のFILEがあるCUEシートでは分割元と同じ名前になることがあるので、その場合は_splitを付ける。
+func splitFileName(track *model.Track, sourcePaths []string) string {
+	name := fmt.Sprintf("%02d", track.TrackNumber)
+	if track.TotalDiscs > 1 {
+		name = fmt.Sprintf("%d-%02d", track.DiscNumber, track.TrackNumber)
+	}
+
+	for _, sourcePath := range sourcePaths {
+		if strings.EqualFold(filepath.Base(sourcePath), name+".flac") {
+			return name + "_split.flac"
+		}
+	}
+	return name + ".flac"
+}
+
+// 分割元に埋め込まれたアートワークをインポートで引き継ぐためにFolder.jpgなどに出力する。
+// 既にアートワークのファイルがあれば何もしない。
+func exportSourceImage(dir string, sourcePath string) error {
+	existing := &model.Track{}
+	err := tags_file.ReadImageFile(dir, []*model.Track{existing})
+	if err != nil {
+		return err
+	}
+	if existing.Image != nil {
+		return nil
+	}
+
+	handler := &flac.FlacHandler{}
+	source, err := handler.ReadTrack(sourcePath)
+	if err != nil {
+		return errors.New("分割元のタグ情報の読み込みに失敗しました。")
+	}
+
+	return tags_file.WriteImageFile(source)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/solidcopy/utag/internal/cue"
+)
+
+func TestValidateCueIndexes(t *testing.T) {
+	newTrack := func(number int, file string, indexes map[int]int) *cue.Track {
+		return &cue.Track{Number: number, File: file, Indexes: indexes}
+	}
+
+	tests := []struct {
+		name    string
+		tracks  []*cue.Track
+		wantErr string
+	}{
+		{"正常", []*cue.Track{
+			newTrack(1, "a.flac", map[int]int{1: 0}),
+			newTrack(2, "a.flac", map[int]int{0: 90, 1: 100}),
+		}, ""},
+		{"ファイルが変われば最初からになる", []*cue.Track{
+			newTrack(1, "a.flac", map[int]int{1: 100}),
+			newTrack(2, "b.flac", map[int]int{1: 0}),
+		}, ""},
+		{"INDEX 01がない", []*cue.Track{
+			newTrack(1, "a.flac", map[int]int{1: 0}),
+			newTrack(2, "a.flac", map[int]int{0: 100}),
+		}, "トラック2のINDEX 01がありません。"},
+		{"INDEX 01が前のトラックと同じ", []*cue.Track{
+			newTrack(1, "a.flac", map[int]int{1: 0}),
+			newTrack(2, "a.flac", map[int]int{1: 100}),
+			newTrack(3, "a.flac", map[int]int{1: 100}),
+		}, "トラック3のINDEX 01が前のトラックより後になっていません。"},
+		{"INDEX 01が前のトラックより前", []*cue.Track{
+			newTrack(1, "a.flac", map[int]int{1: 200}),
+			newTrack(2, "a.flac", map[int]int{1: 100}),
+		}, "トラック2のINDEX 01が前のトラックより後になっていません。"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCueIndexes([]*cue.Sheet{{Tracks: tt.tracks}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
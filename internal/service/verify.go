@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/solidcopy/utag/internal/config"
+	"github.com/solidcopy/utag/internal/handler"
+)
+
+// ディレクトリのオーディオファイルが壊れていないか確認する。
+func ExecuteVerify(dir string, conf *config.Config) {
+	fmt.Println("検査処理を開始します。")
+
+	filePaths, err := FindAudioFiles(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	handler, err := handler.NewHandler(filePaths[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	errorCount := 0
+	for _, filePath := range filePaths {
+		err = verifyFile(handler, filePath)
+		if err != nil {
+			fmt.Printf("NG %s: %s\n", filepath.Base(filePath), err)
+			errorCount++
+		} else {
+			fmt.Printf("OK %s\n", filepath.Base(filePath))
+		}
+	}
+
+	if errorCount > 0 {
+		fmt.Printf("%d件のファイルに問題があります。\n", errorCount)
+	}
+
+	fmt.Println("検査処理を完了しました。")
+}
+
+// 音声データを検査し、ハッシュがタグに記録されていれば照合する。
+func verifyFile(handler handler.FileHandler, filePath string) error {
+	err := handler.VerifyFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	track, err := handler.ReadTrack(filePath)
+	if err != nil {
+		return errors.New("タグ情報の読み込みに失敗しました。")
+	}
+
+	if track.AudioHash == "" {
+		return nil
+	}
+
+	audioHash, err := handler.HashAudio(filePath)
+	if err != nil {
+		return err
+	}
+
+	if audioHash != track.AudioHash {
+		return errors.New("音声データのハッシュがタグに記録された値と一致しません。")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package tags_file
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solidcopy/utag/internal/cue"
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// オーディオファイルと同じ名前の.cueファイルのパスを返す。
+func cueFilePath(audioFilePath string) string {
+	return strings.TrimSuffix(audioFilePath, filepath.Ext(audioFilePath)) + ".cue"
+}
+
+// utagが出力した.cueファイルの先頭の行。これがない.cueファイルは手で作成されたものとみなして上書きしない
+const cueFileMarker = "REM COMMENT \"utag\"\n"
+
+// .cueファイルがutagが出力したものならtrueを返す。
+func isGeneratedCueFile(filePath string) bool {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(data), cueFileMarker)
+}
+
+// 区切りがあればオーディオファイルと同じ名前の.cueファイルに出力する。
+// 同じ名前の.cueファイルがutagが出力したものでなければ上書きせずに警告を表示する。
+func WriteCueFile(track *model.Track) error {
+	if len(track.Chapters) == 0 {
+		return nil
+	}
+
+	filePath := cueFilePath(track.FilePath)
+	if _, err := os.Stat(filePath); err == nil && !isGeneratedCueFile(filePath) {
+		fmt.Printf("警告: %sはutagが出力したものではないので上書きしません。\n", filepath.Base(filePath))
+		return nil
+	}
+
+	sheet := cue.FromChapters(track.Chapters, filepath.Base(track.FilePath))
+	sheet.Title = track.Album
+	sheet.Performer = track.AlbumArtist
+	sheet.Date = track.Date
+	if len(track.Genres) > 0 {
+		sheet.Genre = track.Genres[0]
+	}
+
+	return os.WriteFile(filePath, []byte(cueFileMarker+cue.Format(sheet)), 0666)
+}
+
+// オーディオファイルと同じ名前の.cueファイルがあれば区切りとして読み込む。
+func ReadCueFile(track *model.Track) error {
+	filePath := cueFilePath(track.FilePath)
+	if _, err := os.Stat(filePath); err != nil {
+		return nil
+	}
+
+	sheet, err := cue.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	track.Chapters = cue.ToChapters(sheet)
+
+	return nil
+}
+
+// オーディオファイルのリネームに合わせて.cueファイルもリネームし、FILEのファイル名を書き換える。
+// FILEの行以外は書き換えない。
+func RenameCueFile(oldFilePath string, newFilePath string) error {
+	oldCuePath := cueFilePath(oldFilePath)
+	data, err := os.ReadFile(oldCuePath)
+	if err != nil {
+		return nil
+	}
+
+	renamed, err := cue.RenameFile(data, filepath.Base(oldFilePath), filepath.Base(newFilePath))
+	if err != nil {
+		return err
+	}
+
+	newCuePath := cueFilePath(newFilePath)
+	err = os.Rename(oldCuePath, newCuePath)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(renamed, data) {
+		return nil
+	}
+	return os.WriteFile(newCuePath, renamed, 0666)
+}
@@ -0,0 +1,126 @@
+package tags_file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/solidcopy/utag/internal/cue"
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestRenameCueFile(t *testing.T) {
+	tests := []struct {
+		name string
+		sjis bool
+	}{
+		{"UTF-8", false},
+		{"Shift_JIS", true},
+	}
+
+	sheet := "REM GENRE Anime\r\n" +
+		"REM DATE 2016\r\n" +
+		"CATALOG 4534530091741\r\n" +
+		"PERFORMER \"物語シリーズ\"\r\n" +
+		"TITLE \"歌物語\"\r\n" +
+		"FILE \"旧.flac\" WAVE\r\n" +
+		"  TRACK 01 AUDIO\r\n" +
+		"    TITLE \"staple stable\"\r\n" +
+		"    FLAGS DCP\r\n" +
+		"    INDEX 01 00:00:00\r\n" +
+		"  TRACK 02 AUDIO\r\n" +
+		"    TITLE \"帰り道\"\r\n" +
+		"    REM COMPOSER \"神前暁\"\r\n" +
+		"    INDEX 00 04:10:00\r\n" +
+		"    INDEX 01 04:12:00\r\n" +
+		"    INDEX 02 05:00:00\r\n" +
+		"FILE \"別.wav\" WAVE\r\n" +
+		"  TRACK 03 AUDIO\r\n" +
+		"    INDEX 01 00:00:00\r\n"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encode := func(s string) []byte {
+				if !tt.sjis {
+					return []byte(s)
+				}
+				data, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(s))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "旧.cue"), encode(sheet), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = RenameCueFile(filepath.Join(dir, "旧.flac"), filepath.Join(dir, "新.flac"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, "旧.cue")); err == nil {
+				t.Error("元の.cueファイルが残っている")
+			}
+			got, err := os.ReadFile(filepath.Join(dir, "新.cue"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := encode(strings.Replace(sheet, "FILE \"旧.flac\" WAVE", "FILE \"新.flac\" WAVE", 1))
+			if string(got) != string(want) {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRenameCueFileUnquoted(t *testing.T) {
+	dir := t.TempDir()
+	sheet := "FILE old.flac WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n"
+	err := os.WriteFile(filepath.Join(dir, "old.cue"), []byte(sheet), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RenameCueFile(filepath.Join(dir, "old.flac"), filepath.Join(dir, "new.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "new.cue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "FILE \"new.flac\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteCueFileGenre(t *testing.T) {
+	dir := t.TempDir()
+	track := &model.Track{
+		FilePath: filepath.Join(dir, "a.flac"),
+		Album:    "題名",
+		Genres:   []string{"Anime", "J-Pop"},
+		Chapters: []model.Chapter{{Title: "1"}, {Start: time.Second, Title: "2"}},
+	}
+	err := WriteCueFile(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CUEシートには最初のジャンルだけをREM GENREに書く
+	sheet, err := cue.ReadFile(filepath.Join(dir, "a.cue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Genre != "Anime" {
+		t.Errorf("Genre = %q", sheet.Genre)
+	}
+}
@@ -0,0 +1,196 @@
+package tags_file
+
+import (
+	"strings"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// tagsファイルに「キー=値」の形式で書く追加の項目。
+// 複数の値は//で区切る。
+type extraField struct {
+	key string
+	get func(track *model.Track) []string
+	set func(track *model.Track, values []string)
+}
+
+// アルバム情報の後に書く項目
+var albumExtraFields []extraField = []extraField{
+	boolField("compilation", func(t *model.Track) *bool { return &t.Compilation }),
+	stringField("musicbrainz_albumid", func(t *model.Track) *string { return &t.MusicBrainzAlbumID }),
+	stringField("musicbrainz_releasegroupid", func(t *model.Track) *string { return &t.MusicBrainzReleaseGroupID }),
+	listField("musicbrainz_albumartistid", func(t *model.Track) *[]string { return &t.MusicBrainzAlbumArtistIDs }),
+}
+
+// トラック情報の後に書く項目
+var trackExtraFields []extraField = []extraField{
+	stringField("musicbrainz_trackid", func(t *model.Track) *string { return &t.MusicBrainzTrackID }),
+	stringField("musicbrainz_releasetrackid", func(t *model.Track) *string { return &t.MusicBrainzReleaseTrackID }),
+	listField("musicbrainz_artistid", func(t *model.Track) *[]string { return &t.MusicBrainzArtistIDs }),
+}
+
+// 全トラックで値が同じならアルバム情報の後に、そうでなければトラック情報の後に書く項目
+var sharedExtraFields []extraField = []extraField{
+	stringField("originaldate", func(t *model.Track) *string { return &t.OriginalDate }),
+	stringField("recordingdate", func(t *model.Track) *string { return &t.RecordingDate }),
+	listField("genre", func(t *model.Track) *[]string { return &t.Genres }),
+}
+
+func stringField(key string, field func(t *model.Track) *string) extraField {
+	return extraField{
+		key: key,
+		get: func(t *model.Track) []string {
+			if *field(t) == "" {
+				return []string{}
+			}
+			return []string{*field(t)}
+		},
+		set: func(t *model.Track, values []string) {
+			*field(t) = strings.Join(values, "//")
+		},
+	}
+}
+
+// trueの場合だけ書く項目。値がtrueでなければfalseとみなす。
+func boolField(key string, field func(t *model.Track) *bool) extraField {
+	return extraField{
+		key: key,
+		get: func(t *model.Track) []string {
+			if !*field(t) {
+				return []string{}
+			}
+			return []string{"true"}
+		},
+		set: func(t *model.Track, values []string) {
+			*field(t) = len(values) == 1 && values[0] == "true"
+		},
+	}
+}
+
+func listField(key string, field func(t *model.Track) *[]string) extraField {
+	return extraField{
+		key: key,
+		get: func(t *model.Track) []string { return *field(t) },
+		set: func(t *model.Track, values []string) { *field(t) = values },
+	}
+}
+
+// 値を//で区切って1行にする。
+// 改行と\はエスケープし、区切りと紛らわしい/(連続する/と値の先頭と末尾の/)は\/にする。
+func joinValues(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = escapeValue(value)
+	}
+	return strings.Join(escaped, "//")
+}
+
+func escapeValue(value string) string {
+	b := new(strings.Builder)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '/' && (i == 0 || i == len(value)-1 || value[i-1] == '/' || value[i+1] == '/'):
+			b.WriteString(`\/`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// joinValuesで1行にした値を分割してエスケープを戻す。
+// 知らないエスケープは\も含めてそのまま残す。
+func splitValues(s string) []string {
+	values := []string{}
+	b := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			switch s[i+1] {
+			case '\\', '/':
+				b.WriteByte(s[i+1])
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(c)
+				continue
+			}
+			i++
+		case c == '/' && i+1 < len(s) && s[i+1] == '/':
+			values = append(values, b.String())
+			b.Reset()
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(values, b.String())
+}
+
+// 決まった項目以外のタグは「custom.タグの名前」をキーにする。
+const customPrefix = "custom."
+
+func customField(name string) extraField {
+	return extraField{
+		key: customPrefix + name,
+		get: func(t *model.Track) []string { return t.Custom[name] },
+		set: func(t *model.Track, values []string) { t.SetCustom(name, values...) },
+	}
+}
+
+func findExtraField(fields []extraField, key string) (extraField, bool) {
+	for _, field := range append(slices.Clone(fields), sharedExtraFields...) {
+		if field.key == key {
+			return field, true
+		}
+	}
+
+	if name, found := strings.CutPrefix(key, customPrefix); found && name != "" {
+		return customField(name), true
+	}
+
+	return extraField{}, false
+}
+
+// アルバムとトラックのどちらにも書ける項目と、決まった項目以外のタグの項目(名前順)を返す。
+// albumがtrueなら全トラックで値が同じ項目、falseならトラックごとに値が異なる項目を返す。
+func sharedFields(tracks []*model.Track, track *model.Track, album bool) []extraField {
+	isCommon := func(field extraField) bool {
+		return slices.IndexFunc(tracks, func(t *model.Track) bool {
+			return !slices.Equal(field.get(t), field.get(track))
+		}) < 0
+	}
+
+	fields := []extraField{}
+	for _, field := range sharedExtraFields {
+		if isCommon(field) == album {
+			fields = append(fields, field)
+		}
+	}
+
+	names := maps.Keys(track.Custom)
+	slices.Sort(names)
+	for _, name := range names {
+		if field := customField(name); isCommon(field) == album {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// 行頭が空白の行は追加の項目かコメントとみなす。
+func isExtraLine(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
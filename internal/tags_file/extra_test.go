@@ -0,0 +1,123 @@
+package tags_file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+func TestCustomValuesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+	}{
+		{"改行", []string{"1行目\n2行目", "次"}},
+		{"区切り", []string{"AC//DC", "B"}},
+		{"先頭と末尾の/", []string{"/a/", "/", "b/"}},
+		{"URL", []string{"https://example.com/a"}},
+		{"バックスラッシュ", []string{`C:\n\a\\b`}},
+		{"空の値", []string{"", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			track := &model.Track{Album: "題名", Title: "曲", TrackNumber: 1, DiscNumber: 1}
+			track.SetCustom("COMMENT", tt.values...)
+			err := WriteTagsFile(dir, []*model.Track{track}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "tags"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 値の改行で行が増えない
+			if lines := strings.Count(string(data), "\n"); lines != 6 {
+				t.Errorf("行数 = %d\n%s", lines, data)
+			}
+
+			tracks, err := ReadTagsFile(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tracks[0].Custom["COMMENT"]; !slices.Equal(got, tt.values) {
+				t.Errorf("Custom = %q, want %q", got, tt.values)
+			}
+		})
+	}
+}
+
+func TestSplitValues(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"a//b", []string{"a", "b"}},
+		{`a/\/b//c`, []string{"a//b", "c"}},
+		{`a\nb`, []string{"a\nb"}},
+		{`C:\Music`, []string{`C:\Music`}},
+		{"a/b", []string{"a/b"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitValues(tt.s); !slices.Equal(got, tt.want) {
+			t.Errorf("splitValues(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestGenres(t *testing.T) {
+	tests := []struct {
+		name      string
+		genres    [][]string
+		wantLines []string
+	}{
+		{"全トラックで同じならアルバム情報に書く", [][]string{{"J-Pop", "Anime"}, {"J-Pop", "Anime"}}, []string{"  genre=J-Pop//Anime"}},
+		{"異なればトラック情報に書く", [][]string{{"Hip-Hop/Rap"}, {"Pop"}}, []string{"曲1", "  genre=Hip-Hop/Rap", "曲2", "  genre=Pop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tracks := []*model.Track{}
+			for i, genres := range tt.genres {
+				tracks = append(tracks, &model.Track{Album: "題名", Title: "曲" + string(rune('1'+i)), TrackNumber: i + 1, DiscNumber: 1, Genres: genres})
+			}
+			err := WriteTagsFile(dir, tracks, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "tags"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(data), "\n")
+			i := 0
+			for _, line := range lines {
+				if i < len(tt.wantLines) && line == tt.wantLines[i] {
+					i++
+				}
+			}
+			if i < len(tt.wantLines) {
+				t.Errorf("%qがない\n%s", tt.wantLines[i], data)
+			}
+
+			read, err := ReadTagsFile(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, track := range read {
+				if !slices.Equal(track.Genres, tt.genres[i]) {
+					t.Errorf("Genres = %q, want %q", track.Genres, tt.genres[i])
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,14 @@ package tags_file
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
 )
 
 func ReadTagsFile(dir string) ([]*model.Track, error) {
@@ -26,21 +28,36 @@ func ReadTagsFile(dir string) ([]*model.Track, error) {
 	if !scanner.Scan() {
 		return allTracks, nil
 	}
-	album := scanner.Text()
+	album, albumSort := splitReading(scanner.Text())
 
 	if !scanner.Scan() {
 		return allTracks, nil
 	}
-	albumArtist := scanner.Text()
+	albumArtist, albumArtistSort := splitReading(scanner.Text())
 
 	if !scanner.Scan() {
 		return allTracks, nil
 	}
 	date := scanner.Text()
 
-	scanner.Scan()
-	if scanner.Text() != "" {
-		return allTracks, errors.New("tagsファイルの4行目が空白行ではありません。")
+	// アルバム情報の追加の項目は各トラックに設定する
+	albumExtras := []*extraValue{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !isExtraLine(line) {
+			if line != "" {
+				return allTracks, errors.New("tagsファイルのアルバム情報の後が空白行ではありません。")
+			}
+			break
+		}
+
+		extra, err := parseExtraLine(line, albumExtraFields)
+		if err != nil {
+			return allTracks, err
+		}
+		if extra != nil {
+			albumExtras = append(albumExtras, extra)
+		}
 	}
 
 	newDisc := true
@@ -53,6 +70,22 @@ func ReadTagsFile(dir string) ([]*model.Track, error) {
 			continue
 		}
 
+		if isExtraLine(line) {
+			extra, err := parseExtraLine(line, trackExtraFields)
+			if err != nil {
+				return allTracks, err
+			}
+			if extra == nil {
+				continue
+			}
+			if newDisc {
+				return allTracks, fmt.Errorf("tagsファイルの\"%s\"の前にトラック情報がありません。", extra.field.key)
+			}
+			tracks := tracksByDisc[len(tracksByDisc)-1]
+			extra.field.set(tracks[len(tracks)-1], extra.values)
+			continue
+		}
+
 		if newDisc {
 			newDisc = false
 			tracksByDisc = append(tracksByDisc, []*model.Track{})
@@ -60,12 +93,38 @@ func ReadTagsFile(dir string) ([]*model.Track, error) {
 
 		tokens := strings.Split(line, "//")
 
+		title, titleSort := splitReading(tokens[0])
+
+		// アーティストの読みは先頭のアーティストのものだけを使う
+		artists := make([]string, 0, len(tokens)-1)
+		artistSort := ""
+		for i, token := range tokens[1:] {
+			artist, reading := splitReading(token)
+			artists = append(artists, artist)
+			if i == 0 {
+				artistSort = reading
+			}
+		}
+		// 読みがなければ、アーティストがいないかアルバムアーティストの場合だけアルバムアーティストの読みを使う
+		if artistSort == "" && (len(artists) == 0 || artists[0] == "" || artists[0] == albumArtist) {
+			artistSort = albumArtistSort
+		}
+
 		track := &model.Track{
-			Album:       album,
-			AlbumArtist: albumArtist,
-			Date:        date,
-			Title:       tokens[0],
-			Artists:     tokens[1:],
+			Album:           album,
+			AlbumArtist:     albumArtist,
+			Date:            date,
+			AlbumSort:       albumSort,
+			AlbumArtistSort: albumArtistSort,
+			Title:           title,
+			Artists:         artists,
+			TitleSort:       titleSort,
+			ArtistSort:      artistSort,
+		}
+
+		// アルバム情報の追加の項目を先に設定し、トラック情報の追加の項目で上書きできるようにする
+		for _, extra := range albumExtras {
+			extra.field.set(track, slices.Clone(extra.values))
 		}
 
 		index := len(tracksByDisc) - 1
@@ -90,6 +149,38 @@ func ReadTagsFile(dir string) ([]*model.Track, error) {
 	return allTracks, nil
 }
 
+type extraValue struct {
+	field  extraField
+	values []string
+}
+
+// 「キー=値」の形式の行を解析する。
+// コメント(#で始まる行)ならnilを返す。
+func parseExtraLine(line string, fields []extraField) (*extraValue, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return nil, fmt.Errorf("tagsファイルの追加の項目が「キー=値」の形式ではありません。 \"%s\"", line)
+	}
+
+	field, ok := findExtraField(fields, strings.TrimSpace(key))
+	if !ok {
+		return nil, fmt.Errorf("tagsファイルの追加の項目のキーが不正です。 \"%s\"", key)
+	}
+
+	return &extraValue{field: field, values: splitValues(strings.TrimSpace(value))}, nil
+}
+
+// 「値||読み」の形式の文字列を値と読みに分ける。
+func splitReading(s string) (string, string) {
+	value, reading, _ := strings.Cut(s, "||")
+	return value, reading
+}
+
 func ReadImageFile(dir string, tracks []*model.Track) error {
 	extsToMime := map[string]string{".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png"}
 	for ext, mimeType := range extsToMime {
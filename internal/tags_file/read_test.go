@@ -0,0 +1,103 @@
+package tags_file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/solidcopy/utag/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+func TestArtistSort(t *testing.T) {
+	tests := []struct {
+		name           string
+		line           string
+		wantArtists    []string
+		wantArtistSort string
+	}{
+		{"アーティストがいなければアルバムアーティストの読み", "曲", []string{}, "あるばむ"},
+		{"アルバムアーティストならアルバムアーティストの読み", "曲//アルバム", []string{"アルバム"}, "あるばむ"},
+		{"他のアーティストにはアルバムアーティストの読みを使わない", "曲//ゲスト", []string{"ゲスト"}, ""},
+		{"書いた読みを使う", "曲//ゲスト||げすと//その他||そのた", []string{"ゲスト", "その他"}, "げすと"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "tags"), []byte("題名\nアルバム||あるばむ\n2020-01-01\n\n"+tt.line+"\n"), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tracks, err := ReadTagsFile(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(tracks[0].Artists, tt.wantArtists) {
+				t.Errorf("Artists = %q, want %q", tracks[0].Artists, tt.wantArtists)
+			}
+			if tracks[0].ArtistSort != tt.wantArtistSort {
+				t.Errorf("ArtistSort = %q, want %q", tracks[0].ArtistSort, tt.wantArtistSort)
+			}
+		})
+	}
+}
+
+func TestWriteArtistSort(t *testing.T) {
+	tests := []struct {
+		name       string
+		artists    []string
+		artistSort string
+	}{
+		{"ゲストの読み", []string{"ゲスト"}, "げすと"},
+		{"ゲストの読みがアルバムアーティストの読みと同じ", []string{"ゲスト"}, "あるばむ"},
+		{"ゲストの読みがない", []string{"ゲスト"}, ""},
+		{"アルバムアーティストの別の読み", []string{"アルバム"}, "べつ"},
+		{"アーティストがいない別の読み", []string{}, "べつ"},
+		{"アルバムアーティストとゲスト", []string{"アルバム", "ゲスト"}, "あるばむ"},
+		{"アルバムアーティストの別の読みとゲスト", []string{"アルバム", "ゲスト"}, "べつ"},
+		{"アルバムアーティストとゲストで読みがない", []string{"アルバム", "ゲスト"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			track := &model.Track{
+				Album:           "題名",
+				AlbumArtist:     "アルバム",
+				AlbumArtistSort: "あるばむ",
+				Title:           "曲",
+				Artists:         tt.artists,
+				ArtistSort:      tt.artistSort,
+				TrackNumber:     1,
+				DiscNumber:      1,
+			}
+			err := WriteTagsFile(dir, []*model.Track{track}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tracks, err := ReadTagsFile(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tracks[0].ArtistSort != tt.artistSort {
+				t.Errorf("ArtistSort = %q, want %q", tracks[0].ArtistSort, tt.artistSort)
+			}
+			got := withAlbumArtist(tracks[0])
+			want := withAlbumArtist(track)
+			if !slices.Equal(got, want) {
+				t.Errorf("Artists = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// アルバムアーティストを先頭に加えたアーティスト
+func withAlbumArtist(track *model.Track) []string {
+	artists := slices.DeleteFunc(slices.Clone(track.Artists), func(a string) bool {
+		return a == track.AlbumArtist
+	})
+	return slices.Insert(artists, 0, track.AlbumArtist)
+}
@@ -0,0 +1,73 @@
+package tags_file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/solidcopy/utag/internal/model"
+)
+
+// 音声ストリームの情報を出力するファイルの名前
+const streamInfoFileName = "streaminfo"
+
+// 各トラックの音声ストリームの情報をタブ区切りでstreaminfoファイルに書き込む。
+func WriteStreamInfoFile(dir string, tracks []*model.Track) error {
+	streamInfoFile, err := os.Create(filepath.Join(dir, streamInfoFileName))
+	if err != nil {
+		return err
+	}
+	defer streamInfoFile.Close()
+
+	streamInfoFile.WriteString("ファイル\t再生時間\tコーデック\tサンプリング周波数\t量子化ビット数\tチャンネル数\tビットレート\n")
+
+	for _, track := range tracks {
+		stream := track.Stream
+		columns := []string{
+			filepath.Base(track.FilePath),
+			formatDuration(stream.Duration),
+			stream.Codec,
+			formatUnknown(stream.SampleRate, "Hz"),
+			formatUnknown(stream.BitDepth, "bit"),
+			formatUnknown(stream.Channels, "ch"),
+			formatUnknown(stream.Bitrate/1000, "kbps"),
+		}
+		streamInfoFile.WriteString(strings.Join(columns, "\t"))
+		streamInfoFile.WriteString("\n")
+	}
+
+	return nil
+}
+
+// 「3:25.40 FLAC 44100Hz 16bit 2ch 1021kbps」の形式にする。
+// 不明な項目は省略する。
+func formatStreamInfo(stream model.StreamInfo) string {
+	values := []string{formatDuration(stream.Duration)}
+	for _, value := range []string{
+		stream.Codec,
+		formatUnknown(stream.SampleRate, "Hz"),
+		formatUnknown(stream.BitDepth, "bit"),
+		formatUnknown(stream.Channels, "ch"),
+		formatUnknown(stream.Bitrate/1000, "kbps"),
+	} {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func formatDuration(duration time.Duration) string {
+	minutes := int(duration / time.Minute)
+	seconds := (duration % time.Minute).Seconds()
+	return fmt.Sprintf("%d:%05.2f", minutes, seconds)
+}
+
+func formatUnknown(value int, unit string) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%s", value, unit)
+}
@@ -1,6 +1,7 @@
 package tags_file
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,12 +10,11 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-func WriteTagsFile(tracks []*model.Track) error {
+// withStreamInfoがtrueなら各トラックの後に音声ストリームの情報をコメントとして書き込む。
+func WriteTagsFile(dir string, tracks []*model.Track, withStreamInfo bool) error {
 
 	track := tracks[0]
 
-	dir := filepath.Dir(track.FilePath)
-
 	tagsFilePath := filepath.Join(dir, "tags")
 
 	tagsFile, err := os.Create(tagsFilePath)
@@ -23,12 +23,14 @@ func WriteTagsFile(tracks []*model.Track) error {
 	}
 	defer tagsFile.Close()
 
-	tagsFile.WriteString(track.Album)
+	tagsFile.WriteString(withReading(track.Album, track.AlbumSort))
 	tagsFile.WriteString("\n")
-	tagsFile.WriteString(track.AlbumArtist)
+	tagsFile.WriteString(withReading(track.AlbumArtist, track.AlbumArtistSort))
 	tagsFile.WriteString("\n")
 	tagsFile.WriteString(track.Date)
 	tagsFile.WriteString("\n")
+	writeExtraLines(tagsFile, track, albumExtraFields)
+	writeExtraLines(tagsFile, track, sharedFields(tracks, track, true))
 
 	tagsFile.WriteString("\n")
 
@@ -41,22 +43,70 @@ func WriteTagsFile(tracks []*model.Track) error {
 			curDiscNumber = track.DiscNumber
 		}
 
-		tagsFile.WriteString(track.Title)
+		tagsFile.WriteString(withReading(track.Title, track.TitleSort))
 
-		artists := slices.DeleteFunc(track.Artists, func(a string) bool {
+		artists := slices.DeleteFunc(slices.Clone(track.Artists), func(a string) bool {
 			return a == "" || a == track.AlbumArtist
 		})
+		// アーティストの読みは先頭のアーティストに付ける。
+		// 先頭のアーティストがアルバムアーティストなら読みはアルバムアーティストのものなので、
+		// アルバムアーティストも書く。読みがアルバムアーティストの読みと同じで、
+		// 他にアーティストがいなければ読み込む時に補われるので省略できる。
+		primaryArtist := ""
+		if i := slices.IndexFunc(track.Artists, func(a string) bool { return a != "" }); i >= 0 {
+			primaryArtist = track.Artists[i]
+		}
+		if primaryArtist != "" && primaryArtist != track.AlbumArtist {
+			artists[0] = withReading(artists[0], track.ArtistSort)
+		} else if track.AlbumArtist != "" && track.ArtistSort != "" &&
+			(len(artists) > 0 || track.ArtistSort != track.AlbumArtistSort) {
+			reading := track.ArtistSort
+			if reading == track.AlbumArtistSort {
+				reading = ""
+			}
+			artists = slices.Insert(artists, 0, withReading(track.AlbumArtist, reading))
+		}
 		if len(artists) > 0 {
 			tagsFile.WriteString("//")
 			tagsFile.WriteString(strings.Join(artists, "//"))
 		}
 
 		tagsFile.WriteString("\n")
+		writeExtraLines(tagsFile, track, trackExtraFields)
+		writeExtraLines(tagsFile, track, sharedFields(tracks, track, false))
+
+		if withStreamInfo {
+			tagsFile.WriteString("  # ")
+			tagsFile.WriteString(formatStreamInfo(track.Stream))
+			tagsFile.WriteString("\n")
+		}
 	}
 
 	return nil
 }
 
+// 値のある追加の項目を「  キー=値」の形式で書き込む。
+func writeExtraLines(w io.StringWriter, track *model.Track, fields []extraField) {
+	for _, field := range fields {
+		values := field.get(track)
+		if len(values) == 0 {
+			continue
+		}
+		w.WriteString("  ")
+		w.WriteString(field.key)
+		w.WriteString("=")
+		w.WriteString(joinValues(values))
+		w.WriteString("\n")
+	}
+}
+
+func withReading(value string, reading string) string {
+	if reading == "" {
+		return value
+	}
+	return value + "||" + reading
+}
+
 func isDiscNumberConsistent(tracks []*model.Track) bool {
 	currentDiscNumber := 1
 	for _, track := range tracks {
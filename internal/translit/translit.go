@@ -0,0 +1,177 @@
+package translit
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// 文字列をASCII文字だけの文字列に変換する。
+// 全角英数記号は半角に、かなはローマ字(ヘボン式)に、アクセント付きのラテン文字は
+// アクセントを除いた文字に変換する。
+// 変換できない文字(漢字など)は削除する。
+func ToASCII(s string) string {
+	// 全角英数記号を半角に、半角カナを全角に揃えてから結合文字を合成する
+	s, _, _ = transform.String(transform.Chain(width.Fold, norm.NFC), s)
+
+	s = kanaToRomaji(s)
+
+	replaced := new(strings.Builder)
+	for _, r := range s {
+		if to, ok := symbolMap[r]; ok {
+			replaced.WriteString(to)
+		} else {
+			replaced.WriteRune(r)
+		}
+	}
+
+	// アクセント記号を分解して取り除く
+	s, _, _ = transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn))), replaced.String())
+
+	ascii := new(strings.Builder)
+	for _, r := range s {
+		if r < unicode.MaxASCII && unicode.IsPrint(r) {
+			ascii.WriteRune(r)
+		} else if unicode.IsSpace(r) {
+			ascii.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(ascii.String()), " ")
+}
+
+// 分解してもASCIIにならない文字と記号の置き換え
+var symbolMap map[rune]string = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D",
+	'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "TH", 'ı': "i",
+	'、': ",", '。': ".", '・': " ", '〜': "~", '…': "...",
+	'‐': "-", '–': "-", '—': "-", '―': "-",
+	'‘': "'", '’': "'", '“': "\"", '”': "\"",
+	'「': "'", '」': "'", '『': "'", '』': "'",
+	'【': "[", '】': "]", '〔': "(", '〕': ")", '〈': "<", '〉': ">",
+	'♪': " ", '☆': " ", '★': " ", '♡': " ", '♥': " ",
+}
+
+var kanaMap map[rune]string = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'ゔ': "vu", 'ゕ': "ka", 'ゖ': "ke", 'ゎ': "wa",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo",
+}
+
+// 小書きの母音と組み合わせて別の音になるもの
+var smallVowelMap map[string]string = map[string]string{
+	"uぁ": "wa", "uぃ": "wi", "uぇ": "we", "uぉ": "wo",
+	"teぃ": "ti", "deぃ": "di", "toぅ": "tu", "doぅ": "du",
+	"iぇ": "ye", "shiぇ": "she", "chiぇ": "che", "jiぇ": "je",
+}
+
+func kanaToRomaji(s string) string {
+	src := []rune(s)
+	dst := new(strings.Builder)
+
+	sokuon := false
+	for i := 0; i < len(src); i++ {
+		r := toHiragana(src[i])
+
+		if r == 'っ' {
+			sokuon = true
+			continue
+		}
+
+		if r == 'ー' {
+			if vowel := lastVowel(dst.String()); vowel != 0 {
+				dst.WriteRune(vowel)
+			} else {
+				dst.WriteRune('-')
+			}
+			sokuon = false
+			continue
+		}
+
+		romaji, ok := kanaMap[r]
+		if !ok {
+			dst.WriteRune(src[i])
+			sokuon = false
+			continue
+		}
+
+		// 拗音と小書きの母音は直前のかなと組み合わせる
+		if i+1 < len(src) {
+			next := toHiragana(src[i+1])
+			switch next {
+			case 'ゃ', 'ゅ', 'ょ':
+				if strings.HasSuffix(romaji, "i") && len(romaji) > 1 {
+					stem := strings.TrimSuffix(romaji, "i")
+					if stem == "sh" || stem == "ch" || stem == "j" {
+						romaji = stem + kanaMap[next][1:]
+					} else {
+						romaji = stem + kanaMap[next]
+					}
+					i++
+				}
+			case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ':
+				if combined, ok := smallVowelMap[romaji+string(next)]; ok {
+					romaji = combined
+					i++
+				} else if strings.HasSuffix(romaji, "u") && len(romaji) > 1 {
+					// ふぁ、つぁ、ゔぁなど
+					romaji = strings.TrimSuffix(romaji, "u") + kanaMap[next]
+					i++
+				}
+			}
+		}
+
+		if sokuon {
+			if strings.HasPrefix(romaji, "ch") {
+				dst.WriteByte('t')
+			} else if !strings.ContainsRune("aiueon", rune(romaji[0])) {
+				dst.WriteByte(romaji[0])
+			}
+			sokuon = false
+		}
+
+		dst.WriteString(romaji)
+	}
+
+	return dst.String()
+}
+
+// カタカナをひらがなに変換する。
+// カタカナ以外はそのまま返す。
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+func lastVowel(s string) rune {
+	if s == "" {
+		return 0
+	}
+	last := rune(s[len(s)-1])
+	if strings.ContainsRune("aiueo", last) {
+		return last
+	}
+	return 0
+}
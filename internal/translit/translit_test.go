@@ -0,0 +1,40 @@
+package translit
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"ひらがな", "ありがとう", "arigatou"},
+		{"促音", "がっこう", "gakkou"},
+		{"促音とち", "まっちゃ", "matcha"},
+		{"拗音", "きょう", "kyou"},
+		{"長音", "らーめん", "raamen"},
+		{"カタカナ", "シャッター", "shattaa"},
+		{"小書きの母音", "ティーン", "tiin"},
+		{"ヴ", "ヴァイオリン", "vaiorin"},
+		{"ふぁ", "ふぁいと", "faito"},
+		{"ちぇ", "ちぇんじ", "chenji"},
+		{"ジェ", "ジェット", "jetto"},
+		{"半角カナ", "ﾃｽﾄ", "tesuto"},
+		{"全角英数", "ＡＢＣ１２３", "ABC123"},
+		{"アクセント", "Café Ñandú", "Cafe Nandu"},
+		{"分解できない文字", "Straße", "Strasse"},
+		{"記号", "【歌】〜序章〜", "[]~~"},
+		{"漢字は削除する", "漢字だけ", "dake"},
+		{"空白をまとめる", " a　 b ", "a b"},
+		{"先頭の長音", "ーあ", "-a"},
+		{"促音だけ", "っ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToASCII(tt.s); got != tt.want {
+				t.Errorf("ToASCII(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}